@@ -0,0 +1,314 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// ErrOpen is returned without calling the dependency, Wrap renders it as 503.
+var ErrOpen error = errs.ServiceUnavailable("circuit breaker open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+type Config struct {
+	// Window is the rolling period the failure rate is computed over, split into Buckets.
+	Window  time.Duration
+	Buckets int
+	// MinRequests in the window before the failure rate is trusted.
+	MinRequests int
+	FailureRate float64
+	// OpenTimeout is how long the circuit stays open before letting probes through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes concurrent trial calls, all must succeed to close again.
+	HalfOpenProbes int
+	// IsFailure classifies results, by default any error except caller
+	// cancellation. A cancelled call that isn't a failure counts as neither,
+	// it never reached a verdict on the dependency.
+	IsFailure     func(err error) bool
+	OnStateChange func(name string, from, to State)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Window:         10 * time.Second,
+		Buckets:        10,
+		MinRequests:    20,
+		FailureRate:    0.5,
+		OpenTimeout:    30 * time.Second,
+		HalfOpenProbes: 1,
+	}
+}
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	// canceled frees the call's slot without counting towards either side
+	canceled
+)
+
+func (b *Breaker) classify(err error) outcome {
+	switch {
+	case b.cfg.IsFailure(err):
+		return failure
+	case errors.Is(err, context.Canceled):
+		return canceled
+	default:
+		return success
+	}
+}
+
+type Breaker struct {
+	name string
+	cfg  Config
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	openedAt   time.Time
+	window     window
+	probes     int
+	probeOK    int
+	pending    []func()
+}
+
+func New(name string, cfg Config) *Breaker {
+	def := DefaultConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.Buckets <= 0 {
+		cfg.Buckets = def.Buckets
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = def.MinRequests
+	}
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = def.FailureRate
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = def.OpenTimeout
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = def.HalfOpenProbes
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = defaultIsFailure
+	}
+	return &Breaker{
+		name:   name,
+		cfg:    cfg,
+		window: newWindow(cfg.Window, cfg.Buckets),
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow reserves a call. On success the caller must report the outcome
+// through done exactly once.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	gen := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(gen, b.classify(err)) })
+	}, nil
+}
+
+// Do runs fn unless the circuit is open.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	done(err)
+	return err
+}
+
+// Check reports an open circuit, so a breaker can be added to health.Health
+// directly (usually as a non-critical check).
+func (b *Breaker) Check(ctx context.Context) error {
+	if s := b.State(); s != StateClosed {
+		return fmt.Errorf("circuit %s is %s", b.name, s)
+	}
+	return nil
+}
+
+func (b *Breaker) record(gen uint64, res outcome) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	if gen != b.generation {
+		// the call started before the last state change, its result is stale
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		if res == canceled {
+			return
+		}
+		b.window.add(now, res == failure)
+		total, failures := b.window.totals(now)
+		if total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate {
+			b.transition(now, StateOpen)
+		}
+	case StateHalfOpen:
+		switch res {
+		case failure:
+			b.transition(now, StateOpen)
+			return
+		case canceled:
+			b.probes--
+			return
+		}
+		b.probeOK++
+		if b.probeOK >= b.cfg.HalfOpenProbes {
+			b.transition(now, StateClosed)
+		}
+	}
+}
+
+// refresh moves an expired open circuit to half-open, callers hold mu.
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.transition(now, StateHalfOpen)
+	}
+}
+
+func (b *Breaker) transition(now time.Time, to State) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.probes, b.probeOK = 0, 0
+	switch to {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.window.reset()
+	}
+	if hook := b.cfg.OnStateChange; hook != nil {
+		b.pending = append(b.pending, func() { hook(b.name, from, to) })
+	}
+}
+
+// unlock releases mu and then runs queued state-change hooks, so hooks may
+// query the breaker.
+func (b *Breaker) unlock() {
+	hooks := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// Execute runs fn through b. When the circuit is open or fn fails, fallback
+// (if not nil) is called with the error and its result returned instead.
+func Execute[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error), fallback func(ctx context.Context, err error) (T, error)) (T, error) {
+	var res T
+	err := b.Do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = fn(ctx)
+		return err
+	})
+	if err != nil && fallback != nil {
+		return fallback(ctx, err)
+	}
+	return res, err
+}
+
+// Set keeps one breaker per name, e.g. per host for an HTTP client.
+type Set struct {
+	cfg      Config
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewSet(cfg Config) *Set {
+	return &Set{cfg: cfg, breakers: map[string]*Breaker{}}
+}
+
+func (s *Set) Get(name string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok {
+		b = New(name, s.cfg)
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// Check fails while any breaker in the set is not closed.
+func (s *Set) Check(ctx context.Context) error {
+	s.mu.Lock()
+	breakers := make([]*Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	var failed []error
+	for _, b := range breakers {
+		if err := b.Check(ctx); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
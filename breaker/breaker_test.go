@@ -0,0 +1,205 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+var errBoom = errors.New("boom")
+
+func testConfig() Config {
+	return Config{
+		Window:      time.Second,
+		Buckets:     10,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenTimeout: 20 * time.Millisecond,
+	}
+}
+
+func run(b *Breaker, results ...error) {
+	for _, res := range results {
+		b.Do(context.Background(), func(ctx context.Context) error { return res })
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []error
+		expected State
+	}{
+		{name: "stays closed below min requests", results: []error{errBoom, errBoom, errBoom}, expected: StateClosed},
+		{name: "stays closed below failure rate", results: []error{errBoom, nil, nil, nil, nil}, expected: StateClosed},
+		{name: "opens at failure rate", results: []error{nil, errBoom, nil, errBoom}, expected: StateOpen},
+		{name: "cancellation is not a failure", results: []error{context.Canceled, context.Canceled, context.Canceled, context.Canceled}, expected: StateClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("dep", testConfig())
+			run(b, tt.results...)
+			if s := b.State(); s != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, s)
+			}
+		})
+	}
+}
+
+func TestOpenHalfOpenClosed(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	cfg := testConfig()
+	cfg.OnStateChange = func(name string, from, to State) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, from.String()+"->"+to.String())
+	}
+	b := New("payments", cfg)
+
+	run(b, errBoom, errBoom, errBoom, errBoom)
+	called := false
+	err := b.Do(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrOpen) || called {
+		t.Fatalf("expected ErrOpen without calling, got %v (called %v)", err, called)
+	}
+	var apiErr errs.ApiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 {
+		t.Errorf("expected 503 ApiError, got %v", err)
+	}
+	if err := b.Check(context.Background()); err == nil {
+		t.Error("expected health check to fail while open")
+	}
+
+	time.Sleep(cfg.OpenTimeout)
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("expected half-open, got %s", s)
+	}
+
+	// only one probe at a time
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected second probe to be rejected, got %v", err)
+	}
+	done(nil)
+
+	if s := b.State(); s != StateClosed {
+		t.Errorf("expected closed after successful probe, got %s", s)
+	}
+	if err := b.Check(context.Background()); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, changes)
+		}
+	}
+}
+
+func TestFailedProbeReopens(t *testing.T) {
+	cfg := testConfig()
+	b := New("dep", cfg)
+	run(b, errBoom, errBoom, errBoom, errBoom)
+	time.Sleep(cfg.OpenTimeout)
+
+	run(b, errBoom)
+	if s := b.State(); s != StateOpen {
+		t.Errorf("expected open after failed probe, got %s", s)
+	}
+}
+
+func TestCanceledProbe(t *testing.T) {
+	cfg := testConfig()
+	b := New("dep", cfg)
+	run(b, errBoom, errBoom, errBoom, errBoom)
+	time.Sleep(cfg.OpenTimeout)
+
+	run(b, context.Canceled)
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("expected a cancelled probe to leave the circuit half-open, got %s", s)
+	}
+	// the slot is free again for a real probe
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("expected the probe slot to be released, got %v", err)
+	}
+	done(nil)
+	if s := b.State(); s != StateClosed {
+		t.Errorf("expected closed after a successful probe, got %s", s)
+	}
+}
+
+func TestStaleResultsIgnored(t *testing.T) {
+	cfg := testConfig()
+	b := New("dep", cfg)
+	slow, _ := b.Allow()
+	run(b, errBoom, errBoom, errBoom, errBoom)
+	time.Sleep(cfg.OpenTimeout)
+	b.State()
+
+	// a call started while closed must not close the half-open circuit
+	slow(nil)
+	if s := b.State(); s != StateHalfOpen {
+		t.Errorf("expected half-open, got %s", s)
+	}
+}
+
+func TestWindowExpiry(t *testing.T) {
+	cfg := testConfig()
+	cfg.Window = 40 * time.Millisecond
+	cfg.Buckets = 4
+	b := New("dep", cfg)
+
+	run(b, errBoom, errBoom, errBoom)
+	time.Sleep(2 * cfg.Window)
+	run(b, errBoom)
+	if s := b.State(); s != StateClosed {
+		t.Errorf("expected old failures to age out, got %s", s)
+	}
+}
+
+func TestExecuteFallback(t *testing.T) {
+	b := New("prices", testConfig())
+	run(b, errBoom, errBoom, errBoom, errBoom)
+
+	price, err := Execute(context.Background(), b,
+		func(ctx context.Context) (int, error) { return 100, nil },
+		func(ctx context.Context, err error) (int, error) {
+			if !errors.Is(err, ErrOpen) {
+				t.Errorf("expected ErrOpen in fallback, got %v", err)
+			}
+			return 42, nil
+		})
+	if err != nil || price != 42 {
+		t.Errorf("expected fallback value, got %d %v", price, err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet(testConfig())
+	if set.Get("a") != set.Get("a") || set.Get("a") == set.Get("b") {
+		t.Error("expected one breaker per name")
+	}
+	run(set.Get("b"), errBoom, errBoom, errBoom, errBoom)
+	if err := set.Check(context.Background()); err == nil {
+		t.Error("expected set check to report open breaker")
+	}
+}
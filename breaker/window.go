@@ -0,0 +1,63 @@
+package breaker
+
+import "time"
+
+type bucket struct {
+	total    int
+	failures int
+}
+
+// window counts outcomes over a rolling period in fixed-width buckets, so old
+// results age out without keeping every call.
+type window struct {
+	buckets []bucket
+	width   time.Duration
+	head    int
+	headAt  time.Time
+}
+
+func newWindow(d time.Duration, n int) window {
+	width := d / time.Duration(n)
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return window{buckets: make([]bucket, n), width: width}
+}
+
+func (w *window) advance(now time.Time) {
+	if w.headAt.IsZero() {
+		w.headAt = now.Truncate(w.width)
+		return
+	}
+	steps := int(now.Sub(w.headAt) / w.width)
+	if steps <= 0 {
+		return
+	}
+	for i := 0; i < min(steps, len(w.buckets)); i++ {
+		w.head = (w.head + 1) % len(w.buckets)
+		w.buckets[w.head] = bucket{}
+	}
+	w.headAt = w.headAt.Add(time.Duration(steps) * w.width)
+}
+
+func (w *window) add(now time.Time, failed bool) {
+	w.advance(now)
+	w.buckets[w.head].total++
+	if failed {
+		w.buckets[w.head].failures++
+	}
+}
+
+func (w *window) totals(now time.Time) (total, failures int) {
+	w.advance(now)
+	for _, b := range w.buckets {
+		total += b.total
+		failures += b.failures
+	}
+	return total, failures
+}
+
+func (w *window) reset() {
+	clear(w.buckets)
+	w.headAt = time.Time{}
+}
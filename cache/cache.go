@@ -0,0 +1,177 @@
+// Package cache is a typed key/value cache with loaders, over a local or a
+// shared backend.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwdev22/rest/metrics"
+)
+
+// Backend stores values, Get reports a miss with false and no error.
+type Backend[K comparable, V any] interface {
+	Get(ctx context.Context, key K) (V, bool, error)
+	// Set stores value for ttl, zero meaning until evicted.
+	Set(ctx context.Context, key K, value V, ttl time.Duration) error
+	Delete(ctx context.Context, key K) error
+}
+
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+type Options[K comparable, V any] struct {
+	// TTL for Set and loaded values, zero means no expiry.
+	TTL time.Duration
+	// Loader is used by GetOrLoad when no loader is passed.
+	Loader Loader[K, V]
+	// Metrics registers cache_requests_total and cache_loads_total labelled
+	// with Name.
+	Metrics *metrics.Registry
+	Name    string
+}
+
+type Stats struct {
+	Hits       uint64
+	Misses     uint64
+	Loads      uint64
+	LoadErrors uint64
+	// BackendErrors counts failed backend reads and stores.
+	BackendErrors uint64
+}
+
+type Cache[K comparable, V any] struct {
+	backend Backend[K, V]
+	opts    Options[K, V]
+
+	hits, misses, loads, loadErrors, backendErrors atomic.Uint64
+	requests, loadResults                          *metrics.CounterVec
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func New[K comparable, V any](backend Backend[K, V], opts Options[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{backend: backend, opts: opts, calls: map[K]*call[V]{}}
+	if opts.Metrics != nil {
+		c.requests = opts.Metrics.Counter("cache_requests_total", "Cache lookups by result.", "cache", "result")
+		c.loadResults = opts.Metrics.Counter("cache_loads_total", "Cache loader calls by result.", "cache", "result")
+	}
+	return c
+}
+
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	v, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		c.backendErrors.Add(1)
+		c.count(c.requests, "error")
+		return v, false, err
+	}
+	if ok {
+		c.hits.Add(1)
+		c.count(c.requests, "hit")
+	} else {
+		c.misses.Add(1)
+		c.count(c.requests, "miss")
+	}
+	return v, ok, nil
+}
+
+func (c *Cache[K, V]) Set(ctx context.Context, key K, value V) error {
+	return c.backend.Set(ctx, key, value, c.opts.TTL)
+}
+
+func (c *Cache[K, V]) SetWithTTL(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return c.backend.Set(ctx, key, value, ttl)
+}
+
+func (c *Cache[K, V]) Delete(ctx context.Context, key K) error {
+	return c.backend.Delete(ctx, key)
+}
+
+// GetOrLoad returns the cached value or loads and stores it, concurrent
+// misses for one key share a single load. The load isn't canceled when one
+// caller gives up, and errors are not cached. A nil load uses Options.Loader.
+// A failing backend is counted and bypassed, an outage only makes reads slower.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, load Loader[K, V]) (V, error) {
+	if v, ok, err := c.Get(ctx, key); err == nil && ok {
+		return v, nil
+	}
+	if load == nil {
+		load = c.opts.Loader
+	}
+
+	c.mu.Lock()
+	cl, ok := c.calls[key]
+	if !ok {
+		cl = &call[V]{done: make(chan struct{})}
+		c.calls[key] = cl
+		go c.load(context.WithoutCancel(ctx), key, load, cl)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (c *Cache[K, V]) load(ctx context.Context, key K, load Loader[K, V], cl *call[V]) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	c.loads.Add(1)
+	cl.value, cl.err = c.safeLoad(ctx, key, load)
+	if cl.err != nil {
+		c.loadErrors.Add(1)
+		c.count(c.loadResults, "error")
+		return
+	}
+	c.count(c.loadResults, "ok")
+	// a failed store still hands the loaded value to the callers
+	if err := c.backend.Set(ctx, key, cl.value, c.opts.TTL); err != nil {
+		c.backendErrors.Add(1)
+	}
+}
+
+// safeLoad turns a panic into an error, the load runs on its own goroutine
+// where a panic would take the process down.
+func (c *Cache[K, V]) safeLoad(ctx context.Context, key K, load Loader[K, V]) (v V, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("cache: loader panicked: %v", p)
+		}
+	}()
+	return load(ctx, key)
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Loads:      c.loads.Load(),
+		LoadErrors: c.loadErrors.Load(),
+
+		BackendErrors: c.backendErrors.Load(),
+	}
+}
+
+func (c *Cache[K, V]) count(vec *metrics.CounterVec, result string) {
+	if vec != nil {
+		vec.With(c.opts.Name, result).Inc()
+	}
+}
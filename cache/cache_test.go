@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/metrics"
+	"github.com/mwdev22/rest/resp"
+	"github.com/mwdev22/rest/resp/resptest"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMemoryEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     MemoryOptions[string, string]
+		evicted  string
+		expected []string
+	}{
+		{
+			name:     "lru",
+			opts:     MemoryOptions[string, string]{MaxEntries: 2},
+			evicted:  "b",
+			expected: []string{"a", "c"},
+		},
+		{
+			name:     "lfu",
+			opts:     MemoryOptions[string, string]{Policy: LFU, MaxEntries: 2},
+			evicted:  "b",
+			expected: []string{"a", "c"},
+		},
+		{
+			name:     "cost",
+			opts:     MemoryOptions[string, string]{MaxCost: 8, Cost: func(k, v string) int64 { return int64(len(v)) }},
+			evicted:  "b",
+			expected: []string{"a", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var evicted []string
+			tt.opts.OnEvict = func(k, v string) { evicted = append(evicted, k) }
+			m := NewMemory(tt.opts)
+
+			m.Set(ctx, "a", "aaa", 0)
+			m.Set(ctx, "b", "bbb", 0)
+			// a is read twice, b once: a is both more recent and more frequent
+			m.Get(ctx, "b")
+			m.Get(ctx, "a")
+			m.Get(ctx, "a")
+			m.Set(ctx, "c", "ccc", 0)
+
+			if len(evicted) != 1 || evicted[0] != tt.evicted {
+				t.Errorf("expected %s to be evicted, got %v", tt.evicted, evicted)
+			}
+			for _, key := range tt.expected {
+				if _, ok, _ := m.Get(ctx, key); !ok {
+					t.Errorf("expected %s to stay", key)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLFUKeepsFrequent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(MemoryOptions[string, int]{Policy: LFU, MaxEntries: 2})
+
+	m.Set(ctx, "hot", 1, 0)
+	for range 5 {
+		m.Get(ctx, "hot")
+	}
+	m.Set(ctx, "a", 2, 0)
+	m.Get(ctx, "a")
+	// under LRU hot would go, it was touched longest ago
+	m.Set(ctx, "b", 3, 0)
+
+	if _, ok, _ := m.Get(ctx, "hot"); !ok {
+		t.Error("expected frequently read entry to stay")
+	}
+	if _, ok, _ := m.Get(ctx, "a"); ok {
+		t.Error("expected less frequent entry to be evicted")
+	}
+}
+
+func TestMemoryTTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(MemoryOptions[string, int]{})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.Set(ctx, "short", 1, time.Second)
+	m.Set(ctx, "forever", 2, 0)
+	now = now.Add(2 * time.Second)
+
+	if _, ok, _ := m.Get(ctx, "short"); ok {
+		t.Error("expected entry to expire")
+	}
+	if _, ok, _ := m.Get(ctx, "forever"); !ok {
+		t.Error("expected entry without ttl to stay")
+	}
+	if m.Len() != 1 || m.Cost() != 1 {
+		t.Errorf("expected expired entry to be dropped, got len %d cost %d", m.Len(), m.Cost())
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+	client := resp.NewClient(srv.Addr, resp.Options{})
+	defer client.Close()
+	ctx := context.Background()
+	c := New[int, user](NewRedis[int, user](client, "users:"), Options[int, user]{TTL: time.Minute})
+
+	if err := c.Set(ctx, 1, user{ID: 1, Name: "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := c.Get(ctx, 1)
+	if err != nil || !ok || got.Name != "ann" {
+		t.Errorf("expected ann, got %+v %v %v", got, ok, err)
+	}
+	if _, ok, _ := c.Get(ctx, 2); ok {
+		t.Error("expected miss for unknown key")
+	}
+
+	srv.Advance(2 * time.Minute)
+	if _, ok, _ := c.Get(ctx, 1); ok {
+		t.Error("expected entry to expire")
+	}
+
+	c.SetWithTTL(ctx, 3, user{ID: 3}, 0)
+	c.Delete(ctx, 3)
+	if srv.Keys() != 0 {
+		t.Errorf("expected no keys left, got %d", srv.Keys())
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	backends := map[string]func(t *testing.T) Backend[int, user]{
+		"memory": func(t *testing.T) Backend[int, user] { return NewMemory(MemoryOptions[int, user]{}) },
+		"redis": func(t *testing.T) Backend[int, user] {
+			srv := resptest.NewServer()
+			t.Cleanup(srv.Close)
+			return NewRedis[int, user](resp.NewClient(srv.Addr, resp.Options{}), "users:")
+		},
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			var loads atomic.Int32
+			release := make(chan struct{})
+			reg := metrics.NewRegistry()
+			c := New(newBackend(t), Options[int, user]{
+				Metrics: reg,
+				Name:    "users",
+				Loader: func(ctx context.Context, id int) (user, error) {
+					loads.Add(1)
+					<-release
+					return user{ID: id, Name: "ann"}, nil
+				},
+			})
+
+			var wg sync.WaitGroup
+			results := make([]user, 10)
+			for i := range results {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i], _ = c.GetOrLoad(context.Background(), 1, nil)
+				}()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if loads.Load() != 1 {
+				t.Errorf("expected a single load, got %d", loads.Load())
+			}
+			for _, u := range results {
+				if u.Name != "ann" {
+					t.Errorf("expected every caller to get the loaded value, got %+v", u)
+				}
+			}
+			if u, _ := c.GetOrLoad(context.Background(), 1, nil); u.Name != "ann" || loads.Load() != 1 {
+				t.Errorf("expected cached value without another load, got %+v after %d loads", u, loads.Load())
+			}
+
+			stats := c.Stats()
+			if stats.Hits != 1 || stats.Misses != 10 || stats.Loads != 1 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			var out bytes.Buffer
+			reg.WriteTo(&out)
+			for _, line := range []string{
+				`cache_requests_total{cache="users",result="hit"} 1`,
+				`cache_requests_total{cache="users",result="miss"} 10`,
+				`cache_loads_total{cache="users",result="ok"} 1`,
+			} {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("expected %q in metrics, got\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	c := New(NewMemory(MemoryOptions[string, int]{}), Options[string, int]{})
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	if _, err := c.GetOrLoad(ctx, "k", func(ctx context.Context, key string) (int, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Errorf("expected loader error, got %v", err)
+	}
+	if _, err := c.GetOrLoad(ctx, "k", func(ctx context.Context, key string) (int, error) { panic("bad") }); err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Errorf("expected panic turned into an error, got %v", err)
+	}
+	v, err := c.GetOrLoad(ctx, "k", func(ctx context.Context, key string) (int, error) { return 7, nil })
+	if err != nil || v != 7 {
+		t.Errorf("expected errors not to be cached, got %d %v", v, err)
+	}
+	if c.Stats().LoadErrors != 2 {
+		t.Errorf("expected 2 load errors, got %d", c.Stats().LoadErrors)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.GetOrLoad(canceled, "slow", func(ctx context.Context, key string) (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return 1, nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected caller to give up on cancellation, got %v", err)
+	}
+}
+
+type failingBackend[K comparable, V any] struct{}
+
+func (failingBackend[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var zero V
+	return zero, false, errors.New("connection refused")
+}
+
+func (failingBackend[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingBackend[K, V]) Delete(ctx context.Context, key K) error {
+	return errors.New("connection refused")
+}
+
+func TestGetOrLoadBackendDown(t *testing.T) {
+	c := New[string, int](failingBackend[string, int]{}, Options[string, int]{})
+	ctx := context.Background()
+
+	v, err := c.GetOrLoad(ctx, "k", func(ctx context.Context, key string) (int, error) { return 7, nil })
+	if err != nil || v != 7 {
+		t.Fatalf("expected loader result despite the backend failing, got %d %v", v, err)
+	}
+	if _, _, err := c.Get(ctx, "k"); err == nil {
+		t.Error("expected Get to still report backend errors")
+	}
+	stats := c.Stats()
+	if stats.Loads != 1 || stats.BackendErrors != 3 {
+		t.Errorf("expected 1 load and 3 backend errors, got %+v", stats)
+	}
+}
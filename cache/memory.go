@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+type Policy int
+
+const (
+	// LRU evicts the entry read or written longest ago.
+	LRU Policy = iota
+	// LFU evicts the least read entry, ties go to the older one.
+	LFU
+)
+
+type MemoryOptions[K comparable, V any] struct {
+	Policy Policy
+	// MaxEntries and MaxCost bound the cache, zero means unbounded.
+	MaxEntries int
+	MaxCost    int64
+	// Cost of an entry, e.g. its size in bytes. Every entry costs 1 when nil.
+	Cost    func(key K, value V) int64
+	OnEvict func(key K, value V)
+}
+
+// Memory is a local Backend. Expired entries are dropped when read, or
+// evicted by the policy like any other.
+type Memory[K comparable, V any] struct {
+	mu      sync.Mutex
+	opts    MemoryOptions[K, V]
+	items   map[K]*memoryEntry[K, V]
+	order   entryHeap[K, V]
+	cost    int64
+	tick    uint64
+	evicted uint64
+	now     func() time.Time
+}
+
+type memoryEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+	cost    int64
+	freq    uint64
+	tick    uint64
+	index   int
+}
+
+func NewMemory[K comparable, V any](opts MemoryOptions[K, V]) *Memory[K, V] {
+	m := &Memory[K, V]{opts: opts, items: map[K]*memoryEntry[K, V]{}, now: time.Now}
+	m.order.policy = opts.Policy
+	return m
+}
+
+func (m *Memory[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.items[key]
+	if !ok || m.expired(e) {
+		if ok {
+			m.remove(e)
+		}
+		var zero V
+		return zero, false, nil
+	}
+	m.touch(e)
+	e.freq++
+	heap.Fix(&m.order, e.index)
+	return e.value, true, nil
+}
+
+func (m *Memory[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	var evicted []*memoryEntry[K, V]
+	defer func() {
+		// after unlocking, so OnEvict may use the cache
+		for _, e := range evicted {
+			m.opts.OnEvict(e.key, e.value)
+		}
+	}()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cost := int64(1)
+	if m.opts.Cost != nil {
+		cost = m.opts.Cost(key, value)
+	}
+	if m.opts.MaxCost > 0 && cost > m.opts.MaxCost {
+		// would evict everything and still not fit
+		if e, ok := m.items[key]; ok {
+			m.remove(e)
+		}
+		return nil
+	}
+
+	e, ok := m.items[key]
+	if ok {
+		m.cost -= e.cost
+		e.value = value
+	} else {
+		e = &memoryEntry[K, V]{key: key, value: value}
+		m.items[key] = e
+		heap.Push(&m.order, e)
+	}
+	e.cost = cost
+	e.expires = time.Time{}
+	if ttl > 0 {
+		e.expires = m.now().Add(ttl)
+	}
+	m.cost += cost
+	m.touch(e)
+	heap.Fix(&m.order, e.index)
+
+	for m.order.Len() > 1 && m.overLimit() {
+		victim := m.victim(e)
+		m.remove(victim)
+		m.evicted++
+		if m.opts.OnEvict != nil {
+			evicted = append(evicted, victim)
+		}
+	}
+	return nil
+}
+
+func (m *Memory[K, V]) Delete(ctx context.Context, key K) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.items[key]; ok {
+		m.remove(e)
+	}
+	return nil
+}
+
+// Len counts entries, expired ones included until they are dropped.
+func (m *Memory[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// Cost is the summed cost of all entries.
+func (m *Memory[K, V]) Cost() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cost
+}
+
+// Evictions counts entries removed to make room.
+func (m *Memory[K, V]) Evictions() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evicted
+}
+
+func (m *Memory[K, V]) overLimit() bool {
+	return m.opts.MaxEntries > 0 && len(m.items) > m.opts.MaxEntries ||
+		m.opts.MaxCost > 0 && m.cost > m.opts.MaxCost
+}
+
+// victim is the policy's pick, never the entry just written.
+func (m *Memory[K, V]) victim(written *memoryEntry[K, V]) *memoryEntry[K, V] {
+	if m.order.items[0] != written {
+		return m.order.items[0]
+	}
+	// the new entry sorts first under LFU, take the next best child
+	best := m.order.items[1]
+	if len(m.order.items) > 2 && m.order.less(m.order.items[2], best) {
+		best = m.order.items[2]
+	}
+	return best
+}
+
+func (m *Memory[K, V]) expired(e *memoryEntry[K, V]) bool {
+	return !e.expires.IsZero() && !m.now().Before(e.expires)
+}
+
+func (m *Memory[K, V]) touch(e *memoryEntry[K, V]) {
+	m.tick++
+	e.tick = m.tick
+}
+
+func (m *Memory[K, V]) remove(e *memoryEntry[K, V]) {
+	heap.Remove(&m.order, e.index)
+	delete(m.items, e.key)
+	m.cost -= e.cost
+}
+
+// entryHeap keeps the next eviction candidate on top.
+type entryHeap[K comparable, V any] struct {
+	policy Policy
+	items  []*memoryEntry[K, V]
+}
+
+func (h *entryHeap[K, V]) less(a, b *memoryEntry[K, V]) bool {
+	if h.policy == LFU && a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.tick < b.tick
+}
+
+func (h *entryHeap[K, V]) Len() int           { return len(h.items) }
+func (h *entryHeap[K, V]) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+
+func (h *entryHeap[K, V]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *entryHeap[K, V]) Push(x any) {
+	e := x.(*memoryEntry[K, V])
+	e.index = len(h.items)
+	h.items = append(h.items, e)
+}
+
+func (h *entryHeap[K, V]) Pop() any {
+	old := h.items
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	h.items = old[:len(old)-1]
+	return e
+}
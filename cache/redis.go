@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mwdev22/rest/resp"
+)
+
+// Redis is a Backend shared between instances through a server speaking the
+// Redis protocol. Values are stored as JSON under prefix plus the formatted
+// key, eviction is left to the server's maxmemory-policy.
+type Redis[K comparable, V any] struct {
+	client *resp.Client
+	prefix string
+}
+
+func NewRedis[K comparable, V any](client *resp.Client, prefix string) *Redis[K, V] {
+	return &Redis[K, V]{client: client, prefix: prefix}
+}
+
+func (r *Redis[K, V]) key(key K) string {
+	return r.prefix + fmt.Sprint(key)
+}
+
+func (r *Redis[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var v V
+	b, err := resp.Bytes(r.client.Do(ctx, "GET", r.key(key)))
+	if err != nil || b == nil {
+		return v, false, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+func (r *Redis[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	args := []any{"SET", r.key(key), b}
+	if ttl > 0 {
+		args = append(args, "PX", max(ttl.Milliseconds(), 1))
+	}
+	_, err = r.client.Do(ctx, args...)
+	return err
+}
+
+func (r *Redis[K, V]) Delete(ctx context.Context, key K) error {
+	_, err := r.client.Do(ctx, "DEL", r.key(key))
+	return err
+}
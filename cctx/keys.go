@@ -1,11 +1,18 @@
 package cctx
 
-import "context"
+import (
+	"context"
+	"database/sql"
+)
 
 type ContextKey string
 
 const (
-	RealIpKey ContextKey = "realIP"
+	RealIpKey    ContextKey = "realIP"
+	TraceIDKey   ContextKey = "traceID"
+	SpanKey      ContextKey = "span"
+	RequestIDKey ContextKey = "requestID"
+	TxKey        ContextKey = "tx"
 )
 
 func RealIP(ctx context.Context) string {
@@ -14,3 +21,25 @@ func RealIP(ctx context.Context) string {
 	}
 	return ""
 }
+
+func TraceID(ctx context.Context) string {
+	if val := ctx.Value(TraceIDKey); val != nil {
+		return val.(string)
+	}
+	return ""
+}
+
+func RequestID(ctx context.Context) string {
+	if val := ctx.Value(RequestIDKey); val != nil {
+		return val.(string)
+	}
+	return ""
+}
+
+// Tx returns the transaction started by db.InTx, nil outside of one.
+func Tx(ctx context.Context) *sql.Tx {
+	if val := ctx.Value(TxKey); val != nil {
+		return val.(*sql.Tx)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// maxErrorBody caps how much of a failed response is read for decoding.
+const maxErrorBody = 64 << 10
+
+type Client struct {
+	HTTP    *http.Client
+	BaseURL string
+}
+
+func New(baseURL string, opts Options) *Client {
+	return &Client{
+		HTTP:    &http.Client{Transport: Transport(opts)},
+		BaseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Do sends req and turns non-2xx responses into errs.ApiError, the body of
+// a successful response must be closed by the caller.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// JSON sends in (if not nil) as the request body and decodes a 2xx response into out (if not nil).
+func (c *Client) JSON(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *Client) Get(ctx context.Context, path string, out any) error {
+	return c.JSON(ctx, http.MethodGet, path, nil, out)
+}
+
+func (c *Client) Post(ctx context.Context, path string, in, out any) error {
+	return c.JSON(ctx, http.MethodPost, path, in, out)
+}
+
+// CheckResponse returns nil for 2xx, otherwise it consumes and closes the
+// body and returns an errs.ApiError. Bodies shaped like our own error
+// responses ({"error": "..."}) keep their message, anything else falls back
+// to the status text.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	apiErr := errs.ApiError{
+		StatusCode: resp.StatusCode,
+		Msg:        strings.ToLower(http.StatusText(resp.StatusCode)),
+		Log:        fmt.Sprintf("%s %s: %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status),
+	}
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mt == "application/json" || strings.HasSuffix(mt, "+json") {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &body) == nil && body.Error != "" {
+			apiErr.Msg = body.Error
+		}
+	}
+	if apiErr.Msg == "" {
+		apiErr.Msg = "unexpected status"
+	}
+	if len(raw) > 0 {
+		apiErr.Log += ": " + strings.TrimSpace(string(raw))
+	}
+	return apiErr
+}
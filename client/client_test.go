@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/breaker"
+	"github.com/mwdev22/rest/cctx"
+	"github.com/mwdev22/rest/tracing"
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.BaseDelay = time.Millisecond
+	opts.MaxDelay = 10 * time.Millisecond
+	return opts
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		idempotency   bool
+		failures      int
+		status        int
+		expectedCalls int32
+		expectedCode  int
+	}{
+		{name: "get retried on 503", method: http.MethodGet, failures: 2, status: http.StatusServiceUnavailable, expectedCalls: 3, expectedCode: http.StatusOK},
+		{name: "get retried on 429", method: http.MethodGet, failures: 1, status: http.StatusTooManyRequests, expectedCalls: 2, expectedCode: http.StatusOK},
+		{name: "get gives up after max retries", method: http.MethodGet, failures: 10, status: http.StatusServiceUnavailable, expectedCalls: 4, expectedCode: http.StatusServiceUnavailable},
+		{name: "500 is not retried", method: http.MethodGet, failures: 1, status: http.StatusInternalServerError, expectedCalls: 1, expectedCode: http.StatusInternalServerError},
+		{name: "post not retried", method: http.MethodPost, failures: 1, status: http.StatusServiceUnavailable, expectedCalls: 1, expectedCode: http.StatusServiceUnavailable},
+		{name: "post with idempotency key retried", method: http.MethodPost, idempotency: true, failures: 1, status: http.StatusServiceUnavailable, expectedCalls: 2, expectedCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if body, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && string(body) != "payload" {
+					t.Errorf("expected replayed body, got %q", body)
+				}
+				if int(n) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c := &http.Client{Transport: Transport(testOptions())}
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			if tt.idempotency {
+				req.Header.Set("Idempotency-Key", "k1")
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, resp.StatusCode)
+			}
+			if calls.Load() != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: Transport(testOptions())}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("expected no retry past MaxDelay, got %d calls", calls.Load())
+	}
+}
+
+func TestPerAttemptTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Timeout = 50 * time.Millisecond
+	c := &http.Client{Transport: Transport(opts)}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" || calls.Load() != 2 {
+		t.Errorf("expected second attempt to succeed, got %q after %d calls", body, calls.Load())
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := context.WithValue(context.Background(), cctx.RequestIDKey, "req-1")
+	ctx = tracing.ContextWithRemoteParent(ctx, parent)
+
+	c := New(srv.URL, testOptions())
+	if err := c.Get(ctx, "/", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Get("X-Request-ID") != "req-1" {
+		t.Errorf("expected request id, got %q", got.Get("X-Request-ID"))
+	}
+	if got.Get("traceparent") != parent.Traceparent() {
+		t.Errorf("expected traceparent %s, got %q", parent.Traceparent(), got.Get("traceparent"))
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		expectedMsg string
+	}{
+		{name: "our error body", status: http.StatusNotFound, contentType: "application/json", body: `{"error":"not found"}`, expectedMsg: "not found"},
+		{name: "problem json", status: http.StatusConflict, contentType: "application/problem+json; charset=utf-8", body: `{"error":"conflict"}`, expectedMsg: "conflict"},
+		{name: "plain text", status: http.StatusBadGateway, contentType: "text/plain", body: "upstream down", expectedMsg: "bad gateway"},
+		{name: "malformed json", status: http.StatusBadRequest, contentType: "application/json", body: `{"error":`, expectedMsg: "bad request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL, testOptions()).Get(context.Background(), "/things/1", nil)
+
+			var apiErr errs.ApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected ApiError, got %v", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, apiErr.StatusCode)
+			}
+			if apiErr.Msg != tt.expectedMsg {
+				t.Errorf("expected message '%s', got '%s'", tt.expectedMsg, apiErr.Msg)
+			}
+			if !strings.Contains(apiErr.Log, "/things/1") {
+				t.Errorf("expected request in log, got %s", apiErr.Log)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		d, ok := retryAfter(tt.value)
+		if ok != tt.ok || d != tt.expected {
+			t.Errorf("retryAfter(%q): expected %v %v, got %v %v", tt.value, tt.expected, tt.ok, d, ok)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Breakers = breaker.NewSet(breaker.Config{MinRequests: 2, OpenTimeout: time.Minute})
+	c := New(srv.URL, opts)
+
+	for range 5 {
+		c.Get(context.Background(), "/", nil)
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("expected calls to stop once the circuit opened, got %d", calls.Load())
+	}
+	err := c.Get(context.Background(), "/", nil)
+	if !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("expected ErrOpen, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mwdev22/rest/breaker"
+	"github.com/mwdev22/rest/cctx"
+	"github.com/mwdev22/rest/tracing"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type Options struct {
+	// Timeout bounds a single attempt, the caller's ctx bounds the whole call.
+	Timeout    time.Duration
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// Breakers, when set, short-circuits calls to hosts that keep failing.
+	Breakers *breaker.Set
+	// Base is the innermost transport, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:    10 * time.Second,
+		MaxRetries: 3,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   5 * time.Second,
+	}
+}
+
+// Transport builds the outbound chain: propagation, then the circuit breaker,
+// then retries, then per-attempt timeouts around opts.Base.
+func Transport(opts Options) http.RoundTripper {
+	base := opts.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var next http.RoundTripper = &retry{opts: opts, next: base}
+	if opts.Breakers != nil {
+		next = &guard{breakers: opts.Breakers, next: next}
+	}
+	return &propagate{next: next}
+}
+
+type propagate struct {
+	next http.RoundTripper
+}
+
+func (p *propagate) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	id := cctx.RequestID(ctx)
+	_, traced := tracing.SpanContextFromContext(ctx)
+	if id == "" && !traced {
+		return p.next.RoundTrip(req)
+	}
+
+	req = req.Clone(ctx)
+	if id != "" && req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
+	return p.next.RoundTrip(req)
+}
+
+// guard counts one outcome per logical call (after retries) against the
+// breaker of the target host.
+type guard struct {
+	breakers *breaker.Set
+	next     http.RoundTripper
+}
+
+func (g *guard) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := g.breakers.Get(req.URL.Host).Allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := g.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= 500:
+		done(fmt.Errorf("%s: %s", req.URL.Host, resp.Status))
+	default:
+		done(nil)
+	}
+	return resp, err
+}
+
+type retry struct {
+	opts Options
+	next http.RoundTripper
+}
+
+func (t *retry) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable := isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req, attempt)
+		if !retryable || attempt >= t.opts.MaxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if err == nil {
+			if !shouldRetryStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if ra > t.opts.MaxDelay {
+					// the server asked for longer than we are willing to wait
+					return resp, nil
+				}
+				wait = max(wait, ra)
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *retry) attempt(req *http.Request, n int) (*http.Response, error) {
+	if n > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	if t.opts.Timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the timeout also covers reading the body, release it once the caller closes it
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff is exponential with full jitter.
+func (t *retry) backoff(attempt int) time.Duration {
+	d := t.opts.BaseDelay << attempt
+	if d <= 0 || d > t.opts.MaxDelay {
+		d = t.opts.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	// POST/PATCH are safe to repeat once the server deduplicates them
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetryStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter parses delay-seconds or an HTTP-date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mwdev22/rest/jsonutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Options describe where values come from. Sources are applied in this
+// order, each one overriding the previous:
+//
+//	`default:"..."` tags < Files (in order) < environment < command-line flags
+//
+// Struct fields are named by the `config` tag (snake_case field name when
+// missing). Nested structs become nested keys in files, PREFIX_DB_HOST in the
+// environment and -db.host on the command line. An `env:"NAME"` tag overrides
+// the derived environment variable name.
+//
+// Values of Secret fields and fields tagged `secret:"true"` may be references
+// such as file:///run/secrets/db_password, resolved through Secrets last.
+type Options struct {
+	Files []string
+	// Optional files are skipped when they do not exist instead of failing the load.
+	Optional  bool
+	EnvPrefix string
+	// Args are the command-line arguments without the program name, nil disables flags.
+	Args      []string
+	Validator jsonutil.StructValidator
+	// Secrets maps reference schemes (file://, env://, vault://...) to the
+	// providers resolving them, DefaultSecretProviders when nil.
+	Secrets map[string]SecretProvider
+}
+
+type Loader[T any] struct {
+	opts    Options
+	current atomic.Pointer[T]
+
+	mu        sync.Mutex
+	callbacks []func(old, new T)
+}
+
+func Load[T any](opts Options) (T, error) {
+	l := NewLoader[T](opts)
+	return l.Load()
+}
+
+func NewLoader[T any](opts Options) *Loader[T] {
+	if opts.Validator == nil {
+		opts.Validator = jsonutil.Validate
+	}
+	if opts.Secrets == nil {
+		opts.Secrets = DefaultSecretProviders()
+	}
+	return &Loader[T]{opts: opts}
+}
+
+// Load reads every source, validates the result and makes it Current.
+func (l *Loader[T]) Load() (T, error) {
+	var cfg T
+	if err := l.load(&cfg); err != nil {
+		var zero T
+		return zero, err
+	}
+	l.current.Store(&cfg)
+	return cfg, nil
+}
+
+// Current returns the last successfully loaded configuration.
+func (l *Loader[T]) Current() T {
+	if cfg := l.current.Load(); cfg != nil {
+		return *cfg
+	}
+	var zero T
+	return zero
+}
+
+// OnChange registers a callback invoked after a reload changed the configuration.
+func (l *Loader[T]) OnChange(fn func(old, new T)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.callbacks = append(l.callbacks, fn)
+}
+
+func (l *Loader[T]) load(cfg *T) error {
+	v := reflect.ValueOf(cfg).Elem()
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("config: %T is not a struct", *cfg)
+	}
+	fields := collectFields(v, nil)
+
+	for _, f := range fields {
+		if def, ok := f.tag("default"); ok {
+			if err := setString(f.value, def); err != nil {
+				return fmt.Errorf("config: default for %s: %w", f.key(), err)
+			}
+		}
+	}
+
+	for _, path := range l.opts.Files {
+		values, err := readFile(path)
+		if os.IsNotExist(err) && l.opts.Optional {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+		for _, f := range fields {
+			raw, ok := lookup(values, f.path)
+			if !ok {
+				continue
+			}
+			if err := setAny(f.value, raw); err != nil {
+				return fmt.Errorf("config: %s: %s: %w", path, f.key(), err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		name := f.envName(l.opts.EnvPrefix)
+		if raw, ok := os.LookupEnv(name); ok {
+			if err := setString(f.value, raw); err != nil {
+				return fmt.Errorf("config: env %s: %w", name, err)
+			}
+		}
+	}
+
+	if l.opts.Args != nil {
+		fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+		for _, f := range fields {
+			fs.Var(flagValue{v: f.value, secret: f.secret()}, f.key(), f.tagOr("usage", ""))
+		}
+		if err := fs.Parse(l.opts.Args); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
+	if err := resolveSecrets(context.Background(), fields, l.opts.Secrets); err != nil {
+		return err
+	}
+
+	if err := l.opts.Validator.StructCtx(context.Background(), cfg); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+func readFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	case ".toml":
+		err = toml.Unmarshal(b, &values)
+	default:
+		err = fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+	return values, err
+}
+
+func lookup(values map[string]any, path []string) (any, bool) {
+	var node any = values
+	for _, key := range path {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+type flagValue struct {
+	v      reflect.Value
+	secret bool
+}
+
+func (f flagValue) String() string {
+	if !f.v.IsValid() || f.secret {
+		return ""
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f flagValue) Set(s string) error {
+	return setString(f.v, s)
+}
+
+func (f flagValue) IsBoolFlag() bool {
+	return f.v.IsValid() && f.v.Kind() == reflect.Bool
+}
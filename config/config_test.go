@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type dbConfig struct {
+	Host     string `config:"host" default:"localhost"`
+	Port     int    `config:"port" default:"5432" validate:"min=1,max=65535"`
+	Password string `config:"password" secret:"true"`
+}
+
+type appConfig struct {
+	Name    string        `config:"name" validate:"required"`
+	Debug   bool          `config:"debug"`
+	Timeout time.Duration `config:"timeout" default:"5s"`
+	Origins []string      `config:"origins"`
+	DB      dbConfig      `config:"db"`
+	APIKey  string        `env:"THIRD_PARTY_KEY" secret:"true"`
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "yaml",
+			file:    "app.yaml",
+			content: "name: api\ntimeout: 10s\norigins: [a.com, b.com]\ndb:\n  host: db.internal\n",
+		},
+		{
+			name:    "json",
+			file:    "app.json",
+			content: `{"name":"api","timeout":"10s","origins":["a.com","b.com"],"db":{"host":"db.internal"}}`,
+		},
+		{
+			name:    "toml",
+			file:    "app.toml",
+			content: "name = \"api\"\ntimeout = \"10s\"\norigins = [\"a.com\", \"b.com\"]\n[db]\nhost = \"db.internal\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), tt.file, tt.content)
+
+			cfg, err := Load[appConfig](Options{Files: []string{path}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Name != "api" || cfg.Timeout != 10*time.Second || cfg.DB.Host != "db.internal" {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+			if len(cfg.Origins) != 2 || cfg.Origins[1] != "b.com" {
+				t.Errorf("unexpected origins: %v", cfg.Origins)
+			}
+			if cfg.DB.Port != 5432 {
+				t.Errorf("expected default port, got %d", cfg.DB.Port)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.yaml", "name: base\ndb:\n  host: file-host\n  port: 1111\n")
+	local := writeFile(t, dir, "local.yaml", "db:\n  port: 2222\n")
+
+	t.Setenv("APP_DB_HOST", "env-host")
+	t.Setenv("APP_DEBUG", "true")
+	t.Setenv("THIRD_PARTY_KEY", "k-123")
+
+	cfg, err := Load[appConfig](Options{
+		Files:     []string{base, local, filepath.Join(dir, "missing.yaml")},
+		Optional:  true,
+		EnvPrefix: "app",
+		Args:      []string{"-db.port=3333", "-origins", "x.com,y.com"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Name != "base" {
+		t.Errorf("expected name from file, got %s", cfg.Name)
+	}
+	if cfg.DB.Host != "env-host" {
+		t.Errorf("expected env to override file, got %s", cfg.DB.Host)
+	}
+	if cfg.DB.Port != 3333 {
+		t.Errorf("expected flag to override later file, got %d", cfg.DB.Port)
+	}
+	if !cfg.Debug || cfg.APIKey != "k-123" {
+		t.Errorf("expected env values, got debug=%v key=%s", cfg.Debug, cfg.APIKey)
+	}
+	if strings.Join(cfg.Origins, ",") != "x.com,y.com" {
+		t.Errorf("expected origins from flags, got %v", cfg.Origins)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "validation fails",
+			opts: Options{Files: []string{writeFile(t, dir, "noname.yaml", "debug: true\n")}},
+		},
+		{
+			name: "invalid value",
+			opts: Options{Files: []string{writeFile(t, dir, "bad.yaml", "name: x\ntimeout: soon\n")}},
+		},
+		{
+			name: "missing required file",
+			opts: Options{Files: []string{filepath.Join(dir, "missing.yaml")}},
+		},
+		{
+			name: "unknown flag",
+			opts: Options{Files: []string{writeFile(t, dir, "ok.yaml", "name: x\n")}, Args: []string{"-nope=1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load[appConfig](tt.opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := appConfig{Name: "api", DB: dbConfig{Host: "db", Password: "hunter2"}, APIKey: "k-123"}
+
+	out := String(cfg)
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "k-123") {
+		t.Errorf("secrets leaked: %s", out)
+	}
+	if !strings.Contains(out, `"password":"******"`) || !strings.Contains(out, `"host":"db"`) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "app.yaml", "name: v1\n")
+
+	l := NewLoader[appConfig](Options{Files: []string{path}})
+	if _, err := l.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changes := make(chan [2]string, 1)
+	l.OnChange(func(old, new appConfig) {
+		changes <- [2]string{old.Name, new.Name}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Watch(ctx, 10*time.Millisecond)
+
+	// invalid content is rejected and the previous config stays
+	time.Sleep(20 * time.Millisecond)
+	writeFile(t, filepath.Dir(path), "app.yaml", "debug: true\n")
+	time.Sleep(50 * time.Millisecond)
+	if got := l.Current().Name; got != "v1" {
+		t.Fatalf("expected previous config to stay current, got %q", got)
+	}
+
+	writeFile(t, filepath.Dir(path), "app.yaml", "name: version-2\n")
+	select {
+	case c := <-changes:
+		if c != [2]string{"v1", "version-2"} {
+			t.Errorf("unexpected change: %v", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("change callback was not called")
+	}
+	if got := l.Current().Name; got != "version-2" {
+		t.Errorf("expected reloaded config, got %q", got)
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type field struct {
+	value reflect.Value
+	path  []string
+	sf    reflect.StructField
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) tag(name string) (string, bool) {
+	return f.sf.Tag.Lookup(name)
+}
+
+func (f field) tagOr(name, fallback string) string {
+	if v, ok := f.tag(name); ok {
+		return v
+	}
+	return fallback
+}
+
+func (f field) envName(prefix string) string {
+	if name, ok := f.tag("env"); ok {
+		return name
+	}
+	name := strings.ToUpper(strings.Join(f.path, "_"))
+	if prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+func (f field) secret() bool {
+	v, _ := strconv.ParseBool(f.tagOr("secret", "false"))
+	return v
+}
+
+// collectFields flattens the struct into its leaf fields, nested structs are
+// walked unless they decode themselves from text (time.Time, net.IP, ...).
+func collectFields(v reflect.Value, prefix []string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get("config")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+
+		path := append(append([]string(nil), prefix...), name)
+		fv := v.Field(i)
+		if isLeaf(fv) {
+			fields = append(fields, field{value: fv, path: path, sf: sf})
+			continue
+		}
+		fields = append(fields, collectFields(fv, path)...)
+	}
+	return fields
+}
+
+func isLeaf(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct {
+		return true
+	}
+	return v.Addr().Type().Implements(textUnmarshalerType)
+}
+
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		if s == "" {
+			parts = nil
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setString(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// setAny assigns a value decoded from a file, strings go through setString so
+// "5s" works for durations the same way as in the environment.
+func setAny(v reflect.Value, raw any) error {
+	switch r := raw.(type) {
+	case string:
+		return setString(v, r)
+	case []any:
+		if v.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(v.Type(), len(r), len(r))
+			for i, item := range r {
+				if err := setAny(slice.Index(i), item); err != nil {
+					return err
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v.Addr().Interface())
+}
+
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word on lower->Upper and on the last capital of an acronym (DBHost -> db_host)
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
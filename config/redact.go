@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+const redacted = "******"
+
+// Redacted returns cfg as nested maps keyed like the config files, fields
+// tagged `secret:"true"` are masked. Use it whenever the config is logged.
+func Redacted(cfg any) map[string]any {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	// collectFields needs an addressable value
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+
+	out := map[string]any{}
+	for _, f := range collectFields(c, nil) {
+		node := out
+		for _, key := range f.path[:len(f.path)-1] {
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[key] = child
+			}
+			node = child
+		}
+
+		var value any = f.value.Interface()
+		if f.secret() && !f.value.IsZero() {
+			value = redacted
+		}
+		node[f.path[len(f.path)-1]] = value
+	}
+	return out
+}
+
+func String(cfg any) string {
+	b, err := json.Marshal(Redacted(cfg))
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
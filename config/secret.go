@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+var secretType = reflect.TypeOf(Secret{})
+
+// Secret holds a sensitive value. It prints, logs (fmt, log, slog) and
+// marshals (jsonutil.Write, encoding/json) as a mask, call Value to read it.
+type Secret struct {
+	value string
+}
+
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+func (s Secret) Value() string {
+	return s.value
+}
+
+func (s Secret) IsZero() bool {
+	return s.value == ""
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return "config.Secret{" + redacted + "}"
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+func (s *Secret) UnmarshalText(b []byte) error {
+	s.value = string(b)
+	return nil
+}
+
+// SecretProvider resolves references like vault://path#key, the provider is
+// picked by the reference scheme.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+type SecretProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+// DefaultSecretProviders resolves file:///path and env://NAME references.
+func DefaultSecretProviders() map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"file": FileProvider{},
+		"env":  EnvProvider{},
+	}
+}
+
+// FileProvider reads file:///run/secrets/name, a trailing newline is dropped.
+type FileProvider struct{}
+
+func (FileProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	b, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// EnvProvider reads env://NAME.
+type EnvProvider struct{}
+
+func (EnvProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	v, ok := os.LookupEnv(ref.Host)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref.Host)
+	}
+	return v, nil
+}
+
+// FakeProvider resolves from a map keyed by the full reference, for tests.
+type FakeProvider map[string]string
+
+func (f FakeProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	v, ok := f[ref.String()]
+	if !ok {
+		return "", fmt.Errorf("unknown secret %s", ref)
+	}
+	return v, nil
+}
+
+// resolveSecrets replaces references in Secret fields and fields tagged
+// `secret:"true"`, plain values and unknown schemes are left as they are.
+func resolveSecrets(ctx context.Context, fields []field, providers map[string]SecretProvider) error {
+	for _, f := range fields {
+		isSecret := f.value.Type() == secretType
+		if !isSecret && !(f.secret() && f.value.Kind() == reflect.String) {
+			continue
+		}
+
+		raw := f.value.String()
+		if isSecret {
+			raw = f.value.Interface().(Secret).value
+		}
+		ref, err := url.Parse(raw)
+		if err != nil || !strings.Contains(raw, "://") {
+			continue
+		}
+		provider, ok := providers[ref.Scheme]
+		if !ok {
+			continue
+		}
+
+		resolved, err := provider.Resolve(ctx, ref)
+		if err != nil {
+			// the reference itself may be sensitive (vault paths), only name the field
+			return fmt.Errorf("config: resolving secret %s: %w", f.key(), err)
+		}
+		if isSecret {
+			f.value.Set(reflect.ValueOf(Secret{value: resolved}))
+		} else {
+			f.value.SetString(resolved)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+type secretsConfig struct {
+	DBPassword Secret `config:"db_password" validate:"required"`
+	APIToken   Secret `config:"api_token"`
+	Signing    string `config:"signing" secret:"true"`
+	Callback   string `config:"callback"`
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	pwFile := writeFile(t, dir, "db_password", "s3cret\n")
+	t.Setenv("OTHER_VAR", "from-env")
+
+	cfgFile := writeFile(t, dir, "app.yaml", fmt.Sprintf(
+		"db_password: file://%s\napi_token: vault://secret/data/api#token\nsigning: env://OTHER_VAR\ncallback: env://OTHER_VAR\n",
+		filepath.ToSlash(pwFile),
+	))
+
+	providers := DefaultSecretProviders()
+	providers["vault"] = FakeProvider{"vault://secret/data/api#token": "tok-1"}
+
+	cfg, err := Load[secretsConfig](Options{Files: []string{cfgFile}, Secrets: providers})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.DBPassword.Value() != "s3cret" {
+		t.Errorf("expected file secret, got %q", cfg.DBPassword.Value())
+	}
+	if cfg.APIToken.Value() != "tok-1" {
+		t.Errorf("expected vault secret, got %q", cfg.APIToken.Value())
+	}
+	if cfg.Signing != "from-env" {
+		t.Errorf("expected env secret on tagged string, got %q", cfg.Signing)
+	}
+	if cfg.Callback != "env://OTHER_VAR" {
+		t.Errorf("expected non-secret field untouched, got %q", cfg.Callback)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing file", content: "db_password: file:///does/not/exist\n"},
+		{name: "unset env", content: "db_password: env://NOT_SET_ANYWHERE\n"},
+		{name: "unknown fake secret", content: "db_password: vault://nope#x\n"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, dir, fmt.Sprintf("app%d.yaml", i), tt.content)
+			providers := DefaultSecretProviders()
+			providers["vault"] = FakeProvider{}
+
+			_, err := Load[secretsConfig](Options{Files: []string{path}, Secrets: providers})
+			if err == nil || !strings.Contains(err.Error(), "db_password") {
+				t.Errorf("expected error naming the field, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSecretIsNeverPrinted(t *testing.T) {
+	s := NewSecret("hunter2")
+	cfg := secretsConfig{DBPassword: s}
+
+	var logBuf bytes.Buffer
+	logger := log.New(&logBuf, "", 0)
+	logger.Printf("%v %+v %#v %s", s, cfg, cfg, s)
+
+	var slogBuf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&slogBuf, nil)).Info("cfg", "password", s, "cfg", cfg)
+
+	w := httptest.NewRecorder()
+	if err := jsonutil.Write(w, 200, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	outputs := map[string]string{
+		"log":           logBuf.String(),
+		"slog":          slogBuf.String(),
+		"jsonutil":      w.Body.String(),
+		"config.String": String(cfg),
+	}
+	for name, out := range outputs {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("%s leaked the secret: %s", name, out)
+		}
+		if !strings.Contains(out, redacted) {
+			t.Errorf("%s does not contain the mask: %s", name, out)
+		}
+	}
+
+	if s.Value() != "hunter2" {
+		t.Errorf("expected Value to return the secret")
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch polls the config files every interval and reloads when one of them
+// changed. A reload that fails to parse or validate is logged and the previous
+// configuration stays current. Watch blocks until ctx is cancelled.
+func (l *Loader[T]) Watch(ctx context.Context, interval time.Duration) {
+	stamps := l.stamps()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		next := l.stamps()
+		if reflect.DeepEqual(next, stamps) {
+			continue
+		}
+		stamps = next
+		l.Reload()
+	}
+}
+
+// Reload loads the configuration again and notifies OnChange callbacks when it differs.
+func (l *Loader[T]) Reload() error {
+	old := l.Current()
+	cfg, err := l.Load()
+	if err != nil {
+		log.Printf("config reload failed, keeping previous configuration: %v", err)
+		return err
+	}
+	if reflect.DeepEqual(old, cfg) {
+		return nil
+	}
+
+	l.mu.Lock()
+	callbacks := slices.Clone(l.callbacks)
+	l.mu.Unlock()
+
+	log.Printf("config reloaded")
+	for _, fn := range callbacks {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+func (l *Loader[T]) stamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(l.opts.Files))
+	for _, path := range l.opts.Files {
+		if fi, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
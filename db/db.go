@@ -0,0 +1,168 @@
+// Package db wraps database/sql with pool defaults, context-scoped
+// transactions and error mapping to errs.ApiError.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mwdev22/rest/cctx"
+)
+
+type Options struct {
+	// MaxOpenConns and MaxIdleConns default to 25, a pool that doesn't churn
+	// connections under moderate load.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// PingTimeout bounds the connectivity check in Open, 5s by default.
+	PingTimeout time.Duration
+	// TxRetries is how many times InTx retries after a serialization failure
+	// or deadlock, 3 by default. Negative disables retries.
+	TxRetries int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		PingTimeout:     5 * time.Second,
+		TxRetries:       3,
+	}
+}
+
+// Querier is satisfied by *sql.DB, *sql.Tx and *DB.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// From returns the transaction in ctx, or fallback outside of one.
+func From(ctx context.Context, fallback Querier) Querier {
+	if tx := cctx.Tx(ctx); tx != nil {
+		return tx
+	}
+	return fallback
+}
+
+// DB runs queries in the transaction carried by ctx when there is one, so
+// repositories join InTx without passing *sql.Tx around.
+type DB struct {
+	*sql.DB
+	opts Options
+}
+
+// Open opens a pool with opts (zero fields take DefaultOptions) and pings it.
+func Open(ctx context.Context, driver, dsn string, opts Options) (*DB, error) {
+	pool, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := New(pool, opts)
+
+	pingCtx, cancel := context.WithTimeout(ctx, d.opts.PingTimeout)
+	defer cancel()
+	if err := pool.PingContext(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("db: ping %s: %w", driver, err)
+	}
+	return d, nil
+}
+
+// New wraps an existing pool and applies the pool settings from opts.
+func New(pool *sql.DB, opts Options) *DB {
+	def := DefaultOptions()
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = def.MaxOpenConns
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = def.MaxIdleConns
+	}
+	if opts.ConnMaxLifetime == 0 {
+		opts.ConnMaxLifetime = def.ConnMaxLifetime
+	}
+	if opts.ConnMaxIdleTime == 0 {
+		opts.ConnMaxIdleTime = def.ConnMaxIdleTime
+	}
+	if opts.PingTimeout == 0 {
+		opts.PingTimeout = def.PingTimeout
+	}
+	if opts.TxRetries == 0 {
+		opts.TxRetries = def.TxRetries
+	}
+	pool.SetMaxOpenConns(opts.MaxOpenConns)
+	pool.SetMaxIdleConns(opts.MaxIdleConns)
+	pool.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	return &DB{DB: pool, opts: opts}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return From(ctx, d.DB).ExecContext(ctx, query, args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return From(ctx, d.DB).QueryContext(ctx, query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return From(ctx, d.DB).QueryRowContext(ctx, query, args...)
+}
+
+// InTx runs fn in a transaction carried by the ctx passed to it, committing
+// when fn returns nil and rolling back on an error or panic. Inside another
+// InTx it joins the outer transaction. Serialization failures and deadlocks
+// rerun fn from the start, so fn must not have side effects outside the
+// database.
+func (d *DB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.InTxWith(ctx, nil, fn)
+}
+
+func (d *DB) InTxWith(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if cctx.Tx(ctx) != nil {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := d.runTx(ctx, opts, fn)
+		if err == nil || !IsSerializationFailure(err) || attempt >= d.opts.TxRetries {
+			return err
+		}
+		// full jitter so the conflicting transactions don't collide again
+		backoff := time.Duration(rand.Int64N(int64(10*time.Millisecond) << attempt))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func (d *DB) runTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) (err error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, cctx.TxKey, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("db: rollback: %w", rbErr))
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwdev22/rest/cctx"
+	"github.com/mwdev22/rest/utils/errs"
+	_ "modernc.org/sqlite"
+)
+
+func openTest(t *testing.T) *DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)"
+	d, err := Open(context.Background(), "sqlite", dsn, Options{MaxOpenConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	_, err = d.ExecContext(context.Background(), `
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL UNIQUE);
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id));
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func count(t *testing.T, d *DB, table string) int {
+	t.Helper()
+	var n int
+	if err := d.DB.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name          string
+		fn            func(ctx context.Context, d *DB) error
+		expectedErr   error
+		expectedUsers int
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, d *DB) error {
+				_, err := d.ExecContext(ctx, "INSERT INTO users (email) VALUES ('a@x.io')")
+				return err
+			},
+			expectedUsers: 1,
+		},
+		{
+			name: "rollback on error",
+			fn: func(ctx context.Context, d *DB) error {
+				if _, err := d.ExecContext(ctx, "INSERT INTO users (email) VALUES ('a@x.io')"); err != nil {
+					return err
+				}
+				return boom
+			},
+			expectedErr: boom,
+		},
+		{
+			name: "nested joins outer",
+			fn: func(ctx context.Context, d *DB) error {
+				outer := cctx.Tx(ctx)
+				return d.InTx(ctx, func(ctx context.Context) error {
+					if cctx.Tx(ctx) != outer {
+						return errors.New("expected nested InTx to reuse the transaction")
+					}
+					if _, err := d.ExecContext(ctx, "INSERT INTO users (email) VALUES ('a@x.io')"); err != nil {
+						return err
+					}
+					return boom
+				})
+			},
+			expectedErr: boom,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := openTest(t)
+
+			err := d.InTx(ctx, func(ctx context.Context) error {
+				if cctx.Tx(ctx) == nil {
+					return errors.New("expected transaction in context")
+				}
+				return tt.fn(ctx, d)
+			})
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if n := count(t, d, "users"); n != tt.expectedUsers {
+				t.Errorf("expected %d users, got %d", tt.expectedUsers, n)
+			}
+		})
+	}
+}
+
+func TestInTxPanic(t *testing.T) {
+	d := openTest(t)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to propagate")
+			}
+		}()
+		d.InTx(context.Background(), func(ctx context.Context) error {
+			d.ExecContext(ctx, "INSERT INTO users (email) VALUES ('a@x.io')")
+			panic("boom")
+		})
+	}()
+
+	if n := count(t, d, "users"); n != 0 {
+		t.Errorf("expected rollback after panic, got %d users", n)
+	}
+}
+
+type stateErr string
+
+func (e stateErr) Error() string    { return "pq: " + string(e) }
+func (e stateErr) SQLState() string { return string(e) }
+
+func TestInTxRetry(t *testing.T) {
+	d := openTest(t)
+	attempts := 0
+
+	err := d.InTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if _, err := d.ExecContext(ctx, "INSERT INTO users (email) VALUES (?)", fmt.Sprintf("%d@x.io", attempts)); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return stateErr("40001")
+		}
+		return nil
+	})
+
+	if err != nil || attempts != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d", err, attempts)
+	}
+	if n := count(t, d, "users"); n != 1 {
+		t.Errorf("expected failed attempts to roll back, got %d users", n)
+	}
+
+	attempts = 0
+	err = d.InTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return stateErr("40P01")
+	})
+	if attempts != 4 || !IsSerializationFailure(err) {
+		t.Errorf("expected 1 + 3 retries before giving up, got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestMapError(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+	d.ExecContext(ctx, "INSERT INTO users (id, email) VALUES (1, 'a@x.io')")
+
+	_, uniqueErr := d.ExecContext(ctx, "INSERT INTO users (email) VALUES ('a@x.io')")
+	_, fkErr := d.ExecContext(ctx, "INSERT INTO orders (user_id) VALUES (42)")
+	var email string
+	noRowsErr := d.QueryRowContext(ctx, "SELECT email FROM users WHERE id = 2").Scan(&email)
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "no rows", err: noRowsErr, expectedStatus: http.StatusNotFound},
+		{name: "unique", err: uniqueErr, expectedStatus: http.StatusConflict},
+		{name: "foreign key", err: fkErr, expectedStatus: http.StatusConflict},
+		{name: "postgres unique", err: stateErr("23505"), expectedStatus: http.StatusConflict},
+		{name: "mysql foreign key", err: errors.New("Error 1452 (23000): Cannot add or update a child row"), expectedStatus: http.StatusConflict},
+		{name: "pgx message", err: errors.New(`ERROR: duplicate key value violates unique constraint "users_email_key" (SQLSTATE 23505)`), expectedStatus: http.StatusConflict},
+		{name: "other", err: sql.ErrConnDone},
+		{name: "nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := MapError(tt.err)
+
+			var apiErr errs.ApiError
+			if tt.expectedStatus == 0 {
+				if errors.As(err, &apiErr) || err != tt.err {
+					t.Errorf("expected error unchanged, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %v", tt.expectedStatus, err)
+			}
+			if apiErr.Log == "" {
+				t.Error("expected driver message in Log")
+			}
+		})
+	}
+}
+
+func TestOpenFails(t *testing.T) {
+	if _, err := Open(context.Background(), "sqlite", filepath.Join(t.TempDir(), "missing", "x.db"), Options{}); err == nil {
+		t.Error("expected ping error for unreachable database")
+	}
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// The checks below look at what the common drivers expose without importing
+// them: SQLSTATE codes (pgx, pq), error numbers in the message (MySQL) and
+// result codes (modernc and mattn SQLite).
+
+type sqlStater interface{ SQLState() string }
+
+type sqliteCoder interface{ Code() int }
+
+const (
+	sqliteBusy             = 5
+	sqliteLocked           = 6
+	sqliteBusySnapshot     = 517
+	sqliteConstraintFK     = 787
+	sqliteConstraintPK     = 1555
+	sqliteConstraintUnique = 2067
+)
+
+func sqlState(err error) string {
+	var s sqlStater
+	if errors.As(err, &s) {
+		return s.SQLState()
+	}
+	// pgx and pq messages end with "(SQLSTATE 23505)"
+	msg := err.Error()
+	if i := strings.LastIndex(msg, "SQLSTATE "); i >= 0 && len(msg) >= i+14 {
+		return msg[i+9 : i+14]
+	}
+	return ""
+}
+
+func sqliteCode(err error) int {
+	var c sqliteCoder
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	return 0
+}
+
+// IsSerializationFailure reports errors after which the transaction can be
+// retried as is: serialization failures, deadlocks and busy databases.
+func IsSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch sqlState(err) {
+	case "40001", "40P01":
+		return true
+	}
+	switch sqliteCode(err) {
+	case sqliteBusy, sqliteLocked, sqliteBusySnapshot:
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1213") || strings.Contains(msg, "Error 1205") ||
+		strings.Contains(msg, "database is locked")
+}
+
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if sqlState(err) == "23505" {
+		return true
+	}
+	switch sqliteCode(err) {
+	case sqliteConstraintUnique, sqliteConstraintPK:
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1062") || strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+func IsForeignKeyViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if sqlState(err) == "23503" {
+		return true
+	}
+	if sqliteCode(err) == sqliteConstraintFK {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1451") || strings.Contains(msg, "Error 1452") ||
+		strings.Contains(msg, "FOREIGN KEY constraint failed")
+}
+
+// MapError turns sql.ErrNoRows into a 404 and constraint violations into 409
+// ApiErrors, the driver message only goes to the log. Other errors are
+// returned unchanged for Wrap to render as 500.
+func MapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return errs.NotFound(err.Error())
+	case IsUniqueViolation(err):
+		return errs.Conflict(err.Error())
+	case IsForeignKeyViolation(err):
+		return errs.Conflict(err.Error())
+	}
+	return err
+}
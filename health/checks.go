@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+)
+
+func SQLPing(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+func TCPDial(addr string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// DiskSpace fails when the filesystem holding path has less than minFree bytes available.
+func DiskSpace(path string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		free, err := freeBytes(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s: %d bytes free, need %d", path, free, minFree)
+		}
+		return nil
+	})
+}
+
+// Gate adapts a boolean readiness flag such as server.Server.Ready.
+func Gate(ready func() bool, reason string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if !ready() {
+			return errors.New(reason)
+		}
+		return nil
+	})
+}
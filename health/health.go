@@ -0,0 +1,186 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mwdev22/rest/jsonutil"
+	"github.com/mwdev22/rest/middleware"
+)
+
+const defaultCheckTimeout = 5 * time.Second
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusFailing  Status = "failing"
+)
+
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Options struct {
+	// Critical checks fail readiness, non-critical ones only degrade the report.
+	Critical bool
+	Timeout  time.Duration
+	// CacheTTL reuses the last result for this long so probes do not hammer dependencies.
+	CacheTTL time.Duration
+}
+
+type CheckResult struct {
+	Status     Status    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name    string
+	checker Checker
+	opts    Options
+
+	mu     sync.Mutex
+	last   CheckResult
+	cached bool
+}
+
+type Health struct {
+	mu     sync.RWMutex
+	checks []*check
+}
+
+func New() *Health {
+	return &Health{}
+}
+
+func (h *Health) Add(name string, c Checker, opts Options) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultCheckTimeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, &check{name: name, checker: c, opts: opts})
+}
+
+// Routes mounts /livez, /readyz and /healthz.
+func (h *Health) Routes(r chi.Router) {
+	r.Get("/livez", h.Livez)
+	r.Get("/readyz", h.Readyz)
+	r.Get("/healthz", h.Healthz)
+}
+
+// Livez only tells the process is able to serve requests, dependencies are
+// not checked so a broken database does not get the pod restarted.
+func (h *Health) Livez(w http.ResponseWriter, r *http.Request) {
+	jsonutil.Write(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, h.Run(r.Context()))
+}
+
+// Healthz runs the same checks as Readyz, the per-check report is only
+// returned to callers allowed by middleware.Internal.
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, h.Run(r.Context()))
+}
+
+func (h *Health) write(w http.ResponseWriter, r *http.Request, rep Report) {
+	status := http.StatusOK
+	if rep.Status == StatusFailing {
+		status = http.StatusServiceUnavailable
+	}
+	if !middleware.IsInternal(r) {
+		rep.Checks = nil
+	}
+	jsonutil.Write(w, status, rep)
+}
+
+func (h *Health) Run(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := append([]*check(nil), h.checks...)
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	rep := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		res := results[i]
+		rep.Checks[c.name] = res
+		if res.Status == StatusOK {
+			continue
+		}
+		if c.opts.Critical {
+			rep.Status = StatusFailing
+		} else if rep.Status == StatusOK {
+			rep.Status = StatusDegraded
+		}
+	}
+	return rep
+}
+
+func (c *check) run(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached && time.Since(c.last.CheckedAt) < c.opts.CacheTTL {
+		return c.last
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Status:     StatusOK,
+		Critical:   c.opts.Critical,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000.0,
+		CheckedAt:  start,
+	}
+	if err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+
+	if perr := parent.Err(); perr != nil && !errors.Is(perr, context.DeadlineExceeded) {
+		// the prober gave up, that says nothing about the dependency
+		return res
+	}
+	c.last = res
+	c.cached = c.opts.CacheTTL > 0
+	return res
+}
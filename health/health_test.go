@@ -0,0 +1,197 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/cctx"
+)
+
+func failing(msg string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return errors.New(msg)
+	})
+}
+
+func passing() Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return nil
+	})
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          func(h *Health)
+		ip             string
+		expectedStatus int
+		expectedReport Status
+		expectChecks   bool
+	}{
+		{
+			name: "all passing",
+			setup: func(h *Health) {
+				h.Add("db", passing(), Options{Critical: true})
+			},
+			ip:             "10.0.0.1",
+			expectedStatus: http.StatusOK,
+			expectedReport: StatusOK,
+			expectChecks:   true,
+		},
+		{
+			name: "non-critical failure degrades",
+			setup: func(h *Health) {
+				h.Add("db", passing(), Options{Critical: true})
+				h.Add("search", failing("timeout"), Options{})
+			},
+			ip:             "10.0.0.1",
+			expectedStatus: http.StatusOK,
+			expectedReport: StatusDegraded,
+			expectChecks:   true,
+		},
+		{
+			name: "critical failure",
+			setup: func(h *Health) {
+				h.Add("db", failing("connection refused"), Options{Critical: true})
+			},
+			ip:             "10.0.0.1",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: StatusFailing,
+			expectChecks:   true,
+		},
+		{
+			name: "details hidden from external callers",
+			setup: func(h *Health) {
+				h.Add("db", failing("password authentication failed"), Options{Critical: true})
+			},
+			ip:             "203.0.113.1",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: StatusFailing,
+			expectChecks:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New()
+			tt.setup(h)
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			req = req.WithContext(context.WithValue(req.Context(), cctx.RealIpKey, tt.ip))
+			w := httptest.NewRecorder()
+			h.Readyz(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			var rep Report
+			if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if rep.Status != tt.expectedReport {
+				t.Errorf("expected report status %s, got %s", tt.expectedReport, rep.Status)
+			}
+			if (len(rep.Checks) > 0) != tt.expectChecks {
+				t.Errorf("expected checks visible=%v, got %+v", tt.expectChecks, rep.Checks)
+			}
+		})
+	}
+}
+
+func TestLivezIgnoresChecks(t *testing.T) {
+	h := New()
+	h.Add("db", failing("down"), Options{Critical: true})
+
+	w := httptest.NewRecorder()
+	h.Livez(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+}
+
+func TestCheckTimeoutAndCache(t *testing.T) {
+	var calls atomic.Int32
+	h := New()
+	h.Add("slow", CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}), Options{Critical: true, Timeout: 20 * time.Millisecond, CacheTTL: time.Minute})
+
+	start := time.Now()
+	rep := h.Run(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("check was not bounded by its timeout")
+	}
+	if rep.Status != StatusFailing || rep.Checks["slow"].Error == "" {
+		t.Errorf("expected failing report with error, got %+v", rep)
+	}
+
+	h.Run(context.Background())
+	if calls.Load() != 1 {
+		t.Errorf("expected cached result to be reused, check ran %d times", calls.Load())
+	}
+}
+
+func TestCanceledProbeNotCached(t *testing.T) {
+	var calls atomic.Int32
+	h := New()
+	h.Add("db", CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		return ctx.Err()
+	}), Options{Critical: true, CacheTTL: time.Minute})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if rep := h.Run(canceled); rep.Status != StatusFailing {
+		t.Errorf("expected the cancelled run to fail, got %+v", rep)
+	}
+
+	if rep := h.Run(context.Background()); rep.Status != StatusOK {
+		t.Errorf("expected a fresh run after cancellation, got %+v", rep)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected the check to run again, ran %d times", calls.Load())
+	}
+}
+
+func TestBuiltinChecks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	if err := TCPDial(addr).Check(context.Background()); err != nil {
+		t.Errorf("expected dial to succeed: %v", err)
+	}
+	ln.Close()
+	if err := TCPDial(addr).Check(context.Background()); err == nil {
+		t.Error("expected dial to a closed port to fail")
+	}
+
+	if err := DiskSpace(t.TempDir(), 1).Check(context.Background()); err != nil {
+		t.Errorf("expected disk space check to pass: %v", err)
+	}
+	if err := DiskSpace(t.TempDir(), ^uint64(0)).Check(context.Background()); err == nil {
+		t.Error("expected disk space check to fail for an impossible minimum")
+	}
+
+	ready := false
+	gate := Gate(func() bool { return ready }, "starting")
+	if err := gate.Check(context.Background()); err == nil {
+		t.Error("expected closed gate to fail")
+	}
+	ready = true
+	if err := gate.Check(context.Background()); err != nil {
+		t.Errorf("expected open gate to pass: %v", err)
+	}
+}
@@ -0,0 +1,445 @@
+// Package httpcache caches whole responses of expensive read endpoints on the
+// server side, shared by all clients.
+package httpcache
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+const (
+	// StatusHeader tells clients how the response was served: HIT, STALE,
+	// MISS or BYPASS.
+	StatusHeader = "X-Cache"
+	// TagHeader carries space separated tags from the handler to the cache,
+	// it never reaches the client.
+	TagHeader = "Cache-Tag"
+)
+
+type Options struct {
+	// TTL for responses without s-maxage or max-age, 1 minute by default.
+	TTL time.Duration
+	// Stale is how long an expired entry may still be served while it is
+	// refreshed in the background, unless the response sets
+	// stale-while-revalidate.
+	Stale time.Duration
+	// Headers are request headers that are always part of the key, on top of
+	// whatever the response lists in Vary.
+	Headers []string
+	// MaxBody caps cached bodies, larger responses are served but not stored.
+	// 1 MiB by default.
+	MaxBody int
+	// Statuses that may be cached, 200 only by default.
+	Statuses []int
+}
+
+type Cache struct {
+	store  Store
+	opts   Options
+	flight group
+}
+
+func New(store Store, opts Options) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 1 << 20
+	}
+	if len(opts.Statuses) == 0 {
+		opts.Statuses = []int{http.StatusOK}
+	}
+	opts.Headers = canonicalHeaders(opts.Headers)
+	return &Cache{store: store, opts: opts, flight: group{calls: map[string]*call{}}}
+}
+
+// Tag attaches invalidation tags to the response being written.
+func Tag(w http.ResponseWriter, tags ...string) {
+	w.Header().Add(TagHeader, strings.Join(tags, " "))
+}
+
+// Invalidate drops every entry tagged with any of tags.
+func (c *Cache) Invalidate(ctx context.Context, tags ...string) error {
+	return c.store.Invalidate(ctx, tags...)
+}
+
+// Middleware serves GET and HEAD responses from the store. Fresh entries are
+// HITs, entries within their stale window are served as STALE and refreshed
+// in the background, concurrent misses for one key run the handler once.
+// Register it inside Compress so entries hold the raw body.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		reqCC := parseCacheControl(r.Header.Values("Cache-Control"))
+		if reqCC.has("no-store") {
+			w.Header().Set(StatusHeader, "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		base := c.key(r)
+		var vary []string
+		if !reqCC.has("no-cache") && reqCC["max-age"] != "0" {
+			var e *Entry
+			e, vary = c.lookup(r, base)
+			if e != nil {
+				age := time.Since(e.Stored)
+				if age < e.TTL {
+					serve(w, r, e, "HIT", age)
+					return
+				}
+				serve(w, r, e, "STALE", age)
+				c.revalidate(next, r, base, vary)
+				return
+			}
+		}
+
+		key := variantKey(base, r, vary)
+		cl, leader := c.flight.join(key)
+		if !leader {
+			select {
+			case <-cl.done:
+			case <-r.Context().Done():
+				return
+			}
+			// the leader's response only fits if it varies the same way
+			if e := cl.entry; e != nil && variantKey(base, r, e.Vary) == variantKey(base, cl.req, e.Vary) {
+				serve(w, r, e, "HIT", time.Since(e.Stored))
+				return
+			}
+			w.Header().Set(StatusHeader, "MISS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cl.req = r
+		var e *Entry
+		defer func() { c.flight.finish(key, cl, e) }()
+		rec := &recorder{ResponseWriter: w, max: c.opts.MaxBody}
+		next.ServeHTTP(rec, r)
+		rec.finish()
+		e = c.save(r, base, rec)
+	})
+}
+
+// revalidate refreshes a stale entry with a detached copy of the request,
+// unless a refresh for the key is already running.
+func (c *Cache) revalidate(next http.Handler, r *http.Request, base string, vary []string) {
+	key := variantKey(base, r, vary)
+	cl, leader := c.flight.join(key)
+	if !leader {
+		return
+	}
+	r = r.Clone(detach(r.Context()))
+	cl.req = r
+	go func() {
+		var e *Entry
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("httpcache: revalidate %q panicked: %v", key, err)
+			}
+			c.flight.finish(key, cl, e)
+		}()
+		rec := &recorder{ResponseWriter: &discardWriter{header: http.Header{}}, max: c.opts.MaxBody}
+		next.ServeHTTP(rec, r)
+		rec.finish()
+		e = c.save(r, base, rec)
+	}()
+}
+
+// detach drops the request's cancellation and gives it its own copy of the
+// chi route context, the original goes back to chi's pool and is reset for
+// the next request as soon as the handler returns.
+func detach(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return ctx
+	}
+	cp := chi.NewRouteContext()
+	cp.Routes = rctx.Routes
+	cp.RoutePath = rctx.RoutePath
+	cp.RouteMethod = rctx.RouteMethod
+	cp.RoutePatterns = slices.Clone(rctx.RoutePatterns)
+	cp.URLParams.Keys = slices.Clone(rctx.URLParams.Keys)
+	cp.URLParams.Values = slices.Clone(rctx.URLParams.Values)
+	return context.WithValue(ctx, chi.RouteCtxKey, cp)
+}
+
+func (c *Cache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.URL.Path)
+	if q := r.URL.Query(); len(q) > 0 {
+		// Encode sorts by key so ?a=1&b=2 and ?b=2&a=1 share an entry
+		b.WriteString("?" + q.Encode())
+	}
+	for _, h := range c.opts.Headers {
+		b.WriteString("\n" + h + ": " + strings.Join(r.Header.Values(h), ", "))
+	}
+	return b.String()
+}
+
+func variantKey(base string, r *http.Request, vary []string) string {
+	if len(vary) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	for _, h := range vary {
+		b.WriteString("\n" + h + ": " + strings.Join(r.Header.Values(h), ", "))
+	}
+	return b.String()
+}
+
+// lookup follows the Vary marker stored under the base key to the variant
+// matching r. It returns the Vary list even when the variant is missing.
+func (c *Cache) lookup(r *http.Request, base string) (*Entry, []string) {
+	e, err := c.store.Get(r.Context(), base)
+	if err != nil {
+		log.Printf("httpcache: get %q: %v", base, err)
+		return nil, nil
+	}
+	if e == nil || !e.marker() {
+		return e, nil
+	}
+	vary := e.Vary
+	e, err = c.store.Get(r.Context(), variantKey(base, r, vary))
+	if err != nil {
+		log.Printf("httpcache: get %q: %v", base, err)
+		return nil, vary
+	}
+	return e, vary
+}
+
+// save stores the recorded response if its status and Cache-Control allow.
+func (c *Cache) save(r *http.Request, base string, rec *recorder) *Entry {
+	if rec.skip || !slices.Contains(c.opts.Statuses, rec.status) {
+		return nil
+	}
+	cc := parseCacheControl(rec.header.Values("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") || rec.header.Get("Set-Cookie") != "" {
+		return nil
+	}
+	// responses to authenticated requests are only shared when marked so
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") {
+		return nil
+	}
+
+	ttl := c.opts.TTL
+	if v, ok := cc["s-maxage"]; ok {
+		ttl = seconds(v)
+	} else if v, ok := cc["max-age"]; ok {
+		ttl = seconds(v)
+	}
+	stale := c.opts.Stale
+	if v, ok := cc["stale-while-revalidate"]; ok {
+		stale = seconds(v)
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	var vary []string
+	for _, v := range rec.header.Values("Vary") {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h == "*" {
+				return nil
+			} else if h != "" {
+				vary = append(vary, textproto.CanonicalMIMEHeaderKey(h))
+			}
+		}
+	}
+	vary = canonicalHeaders(vary)
+
+	e := &Entry{
+		Status: rec.status,
+		Header: rec.header,
+		Body:   rec.body,
+		Stored: time.Now(),
+		TTL:    ttl,
+		Stale:  stale,
+		Vary:   vary,
+	}
+	ctx := context.WithoutCancel(r.Context())
+	key := base
+	if len(vary) > 0 {
+		marker := &Entry{Stored: e.Stored, TTL: ttl, Stale: stale, Vary: vary}
+		if err := c.store.Set(ctx, base, marker, rec.tags); err != nil {
+			log.Printf("httpcache: set %q: %v", base, err)
+			return e
+		}
+		key = variantKey(base, r, vary)
+	}
+	if err := c.store.Set(ctx, key, e, rec.tags); err != nil {
+		log.Printf("httpcache: set %q: %v", key, err)
+	}
+	return e
+}
+
+func serve(w http.ResponseWriter, r *http.Request, e *Entry, status string, age time.Duration) {
+	h := w.Header()
+	for k, v := range e.Header {
+		h[k] = slices.Clone(v)
+	}
+	h.Set("Age", strconv.Itoa(int(age.Seconds())))
+	h.Set(StatusHeader, status)
+	if etag := e.Header.Get("ETag"); etag != "" && jsonutil.MatchETag(r.Header.Get("If-None-Match"), etag) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.Status)
+	w.Write(e.Body)
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	cc := cacheControl{}
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func seconds(v string) time.Duration {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+func canonicalHeaders(headers []string) []string {
+	out := make([]string, 0, len(headers))
+	for _, h := range headers {
+		out = append(out, textproto.CanonicalMIMEHeaderKey(h))
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// recorder passes the response through while keeping a copy to store.
+type recorder struct {
+	http.ResponseWriter
+	max int
+
+	status int
+	header http.Header
+	body   []byte
+	tags   []string
+	// skip marks responses that can't be stored, too large or streamed
+	skip bool
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.status != 0 {
+		return
+	}
+	if code < 200 {
+		rec.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rec.status = code
+	h := rec.Header()
+	for _, v := range h.Values(TagHeader) {
+		rec.tags = append(rec.tags, strings.Fields(v)...)
+	}
+	h.Del(TagHeader)
+	rec.header = h.Clone()
+	h.Set(StatusHeader, "MISS")
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.skip {
+		if len(rec.body)+len(b) > rec.max {
+			rec.skip, rec.body = true, nil
+		} else {
+			rec.body = append(rec.body, b...)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Flush() {
+	rec.skip, rec.body = true, nil
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// finish covers handlers that returned without writing anything.
+func (rec *recorder) finish() {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+}
+
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// group coalesces concurrent fills of one key.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done  chan struct{}
+	req   *http.Request
+	entry *Entry
+}
+
+func (g *group) join(key string) (*call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cl, ok := g.calls[key]; ok {
+		return cl, false
+	}
+	cl := &call{done: make(chan struct{})}
+	g.calls[key] = cl
+	return cl, true
+}
+
+func (g *group) finish(key string, cl *call, e *Entry) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	cl.entry = e
+	close(cl.done)
+}
@@ -0,0 +1,349 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mwdev22/rest/resp"
+	"github.com/mwdev22/rest/resp/resptest"
+)
+
+func redisStore(t *testing.T) Store {
+	t.Helper()
+	srv := resptest.NewServer()
+	t.Cleanup(srv.Close)
+	client := resp.NewClient(srv.Addr, resp.Options{})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "test:")
+}
+
+var stores = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store { return NewMemoryStore(0, 0) },
+	"redis":  redisStore,
+}
+
+func get(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func counting(calls *atomic.Int32, cacheControl string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"call":%d}`, n)
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheControl  string
+		requestHeader []string
+		expectedCalls int32
+		expectedCache string
+	}{
+		{name: "cached", expectedCalls: 1, expectedCache: "HIT"},
+		{name: "s-maxage", cacheControl: "public, s-maxage=60", expectedCalls: 1, expectedCache: "HIT"},
+		{name: "max-age zero", cacheControl: "max-age=0", expectedCalls: 2, expectedCache: "MISS"},
+		{name: "no-store", cacheControl: "no-store", expectedCalls: 2, expectedCache: "MISS"},
+		{name: "private", cacheControl: "private, max-age=60", expectedCalls: 2, expectedCache: "MISS"},
+		{name: "request no-cache", requestHeader: []string{"Cache-Control", "no-cache"}, expectedCalls: 2, expectedCache: "MISS"},
+		{name: "request no-store", requestHeader: []string{"Cache-Control", "no-store"}, expectedCalls: 2, expectedCache: "BYPASS"},
+		{name: "authorized", requestHeader: []string{"Authorization", "Bearer x"}, expectedCalls: 2, expectedCache: "MISS"},
+		{name: "authorized public", cacheControl: "public", requestHeader: []string{"Authorization", "Bearer x"}, expectedCalls: 1, expectedCache: "HIT"},
+	}
+
+	for _, tt := range tests {
+		for name, newStore := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				var calls atomic.Int32
+				h := New(newStore(t), Options{}).Middleware(counting(&calls, tt.cacheControl))
+
+				first := get(h, "/items?b=2&a=1", tt.requestHeader...)
+				second := get(h, "/items?a=1&b=2", tt.requestHeader...)
+
+				if calls.Load() != tt.expectedCalls {
+					t.Errorf("expected %d handler calls, got %d", tt.expectedCalls, calls.Load())
+				}
+				if got := second.Header().Get(StatusHeader); got != tt.expectedCache {
+					t.Errorf("expected %s '%s', got '%s'", StatusHeader, tt.expectedCache, got)
+				}
+				if tt.expectedCalls == 1 {
+					if second.Body.String() != first.Body.String() || second.Header().Get("Content-Type") != "application/json" {
+						t.Errorf("expected cached copy of %s, got %s %v", first.Body, second.Body, second.Header())
+					}
+					if second.Header().Get("Age") == "" {
+						t.Error("expected Age header on a hit")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := New(newStore(t), Options{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set("Vary", "accept-language")
+				fmt.Fprint(w, r.Header.Get("Accept-Language"))
+			}))
+
+			get(h, "/greeting", "Accept-Language", "pl")
+			get(h, "/greeting", "Accept-Language", "en")
+			pl := get(h, "/greeting", "Accept-Language", "pl")
+			en := get(h, "/greeting", "Accept-Language", "en")
+
+			if calls.Load() != 2 {
+				t.Errorf("expected one call per language, got %d", calls.Load())
+			}
+			if pl.Body.String() != "pl" || en.Body.String() != "en" {
+				t.Errorf("expected variants pl and en, got %s and %s", pl.Body, en.Body)
+			}
+		})
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			refreshed := make(chan struct{}, 1)
+			h := New(newStore(t), Options{TTL: 20 * time.Millisecond, Stale: time.Hour}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if n > 1 {
+					w.Header().Set("Cache-Control", "max-age=60")
+				}
+				fmt.Fprintf(w, "v%d", n)
+				if n > 1 {
+					select {
+					case refreshed <- struct{}{}:
+					default:
+					}
+				}
+			}))
+
+			get(h, "/report")
+			time.Sleep(30 * time.Millisecond)
+
+			stale := get(h, "/report")
+			if stale.Header().Get(StatusHeader) != "STALE" || stale.Body.String() != "v1" {
+				t.Fatalf("expected stale v1, got %s %s", stale.Header().Get(StatusHeader), stale.Body)
+			}
+			select {
+			case <-refreshed:
+			case <-time.After(time.Second):
+				t.Fatal("expected background refresh")
+			}
+			// the refreshed entry is stored right after the handler returns
+			for range 100 {
+				if w := get(h, "/report"); w.Body.String() != "v1" {
+					if w.Header().Get(StatusHeader) != "HIT" {
+						t.Errorf("expected HIT after refresh, got %s", w.Header().Get(StatusHeader))
+					}
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+			t.Error("expected refreshed body")
+		})
+	}
+}
+
+func TestRevalidateWithChi(t *testing.T) {
+	tests := []struct {
+		name  string
+		mount func(r chi.Router, cache *Cache, h http.HandlerFunc)
+	}{
+		{name: "router middleware", mount: func(r chi.Router, cache *Cache, h http.HandlerFunc) {
+			r.Use(cache.Middleware)
+			r.Get("/reports/{id}", h)
+		}},
+		{name: "route middleware", mount: func(r chi.Router, cache *Cache, h http.HandlerFunc) {
+			r.With(cache.Middleware).Get("/reports/{id}", h)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			gate := make(chan struct{})
+			refreshed := make(chan string, 1)
+			r := chi.NewRouter()
+			tt.mount(r, New(NewMemoryStore(0, 0), Options{TTL: 20 * time.Millisecond, Stale: time.Hour}), func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if n > 1 {
+					// let other requests reuse the pooled route context first
+					<-gate
+					w.Header().Set("Cache-Control", "max-age=60")
+				}
+				body := fmt.Sprintf("report %s v%d", chi.URLParam(r, "id"), n)
+				w.Write([]byte(body))
+				if n > 1 {
+					refreshed <- body
+				}
+			})
+			r.Get("/other/{name}", func(w http.ResponseWriter, r *http.Request) {})
+
+			get(r, "/reports/42")
+			time.Sleep(30 * time.Millisecond)
+			if w := get(r, "/reports/42"); w.Header().Get(StatusHeader) != "STALE" {
+				t.Fatalf("expected STALE, got %s", w.Header().Get(StatusHeader))
+			}
+			for range 10 {
+				get(r, "/other/x")
+			}
+			close(gate)
+
+			select {
+			case body := <-refreshed:
+				if body != "report 42 v2" {
+					t.Errorf("expected refresh to see its own params, got %q", body)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected background refresh to reach the handler")
+			}
+			for range 100 {
+				if w := get(r, "/reports/42"); w.Body.String() != "report 42 v1" {
+					if w.Body.String() != "report 42 v2" {
+						t.Errorf("expected refreshed body, got %q", w.Body.String())
+					}
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+			t.Error("expected refreshed entry to be stored")
+		})
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			release := make(chan struct{})
+			h := New(newStore(t), Options{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				<-release
+				fmt.Fprint(w, "expensive")
+			}))
+
+			var wg sync.WaitGroup
+			bodies := make([]string, 10)
+			for i := range bodies {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bodies[i] = get(h, "/report").Body.String()
+				}()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if calls.Load() != 1 {
+				t.Errorf("expected handler to run once, got %d", calls.Load())
+			}
+			for _, b := range bodies {
+				if b != "expensive" {
+					t.Errorf("expected every caller to get the body, got %q", b)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			cache := New(newStore(t), Options{})
+			h := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				Tag(w, "items", "item:"+r.URL.Query().Get("id"))
+				fmt.Fprint(w, "item")
+			}))
+
+			w := get(h, "/items?id=1")
+			get(h, "/items?id=2")
+			if w.Header().Get(TagHeader) != "" {
+				t.Errorf("expected %s to be stripped, got %s", TagHeader, w.Header().Get(TagHeader))
+			}
+
+			if err := cache.Invalidate(context.Background(), "item:1"); err != nil {
+				t.Fatal(err)
+			}
+			get(h, "/items?id=1")
+			get(h, "/items?id=2")
+			if calls.Load() != 3 {
+				t.Errorf("expected only item 1 to be refetched, got %d calls", calls.Load())
+			}
+
+			if err := cache.Invalidate(context.Background(), "items"); err != nil {
+				t.Fatal(err)
+			}
+			get(h, "/items?id=1")
+			get(h, "/items?id=2")
+			if calls.Load() != 5 {
+				t.Errorf("expected both items to be refetched, got %d calls", calls.Load())
+			}
+		})
+	}
+}
+
+func TestNotModifiedFromCache(t *testing.T) {
+	h := New(NewMemoryStore(0, 0), Options{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "body")
+	}))
+
+	get(h, "/items/1")
+	w := get(h, "/items/1", "If-None-Match", `"v1"`)
+
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected empty 304 from cache, got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2, 0)
+	entry := func() *Entry { return &Entry{Status: http.StatusOK, Stored: time.Now(), TTL: time.Minute} }
+
+	s.Set(ctx, "a", entry(), nil)
+	s.Set(ctx, "b", entry(), nil)
+	s.Get(ctx, "a")
+	s.Set(ctx, "c", entry(), nil)
+
+	if e, _ := s.Get(ctx, "b"); e != nil {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if e, _ := s.Get(ctx, "a"); e == nil {
+		t.Error("expected recently used entry to stay")
+	}
+
+	s = NewMemoryStore(0, 10)
+	s.Set(ctx, "a", &Entry{Status: http.StatusOK, Body: []byte("12345"), Stored: time.Now(), TTL: time.Minute}, nil)
+	s.Set(ctx, "b", &Entry{Status: http.StatusOK, Body: []byte("12345"), Stored: time.Now(), TTL: time.Minute}, nil)
+	if s.Len() != 1 {
+		t.Errorf("expected byte bound to keep 1 entry, got %d", s.Len())
+	}
+}
@@ -0,0 +1,225 @@
+package httpcache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mwdev22/rest/resp"
+)
+
+// Entry is a stored response. An entry without a status is a marker saying
+// the response varies on the listed request headers.
+type Entry struct {
+	Status int           `json:"status,omitempty"`
+	Header http.Header   `json:"header,omitempty"`
+	Body   []byte        `json:"body,omitempty"`
+	Stored time.Time     `json:"stored"`
+	TTL    time.Duration `json:"ttl"`
+	Stale  time.Duration `json:"stale,omitempty"`
+	Vary   []string      `json:"vary,omitempty"`
+}
+
+func (e *Entry) marker() bool {
+	return e.Status == 0
+}
+
+func (e *Entry) expires() time.Time {
+	return e.Stored.Add(e.TTL + e.Stale)
+}
+
+// Store holds entries until TTL plus Stale has passed. Get returns nil
+// without an error on a miss. Entries are shared, don't modify them.
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, e *Entry, tags []string) error
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+type memoryItem struct {
+	key     string
+	entry   *Entry
+	tags    []string
+	expires time.Time
+	size    int64
+}
+
+// MemoryStore is a per-instance LRU bounded by entry count and body bytes,
+// zero meaning unbounded.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	ll         *list.List
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+}
+
+func NewMemoryStore(maxEntries int, maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*memoryItem)
+	if time.Now().After(item.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.ll.MoveToFront(el)
+	return item.entry, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, e *Entry, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+
+	size := int64(len(key) + len(e.Body))
+	for k, v := range e.Header {
+		size += int64(len(k))
+		for _, s := range v {
+			size += int64(len(s))
+		}
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return nil
+	}
+	item := &memoryItem{key: key, entry: e, tags: tags, expires: e.expires(), size: size}
+	s.items[key] = s.ll.PushFront(item)
+	s.size += size
+	for _, tag := range tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = map[string]struct{}{}
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+
+	for s.ll.Len() > 0 && (s.maxEntries > 0 && s.ll.Len() > s.maxEntries || s.maxBytes > 0 && s.size > s.maxBytes) {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Invalidate(ctx context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			if el, ok := s.items[key]; ok {
+				s.remove(el)
+			}
+		}
+		delete(s.tags, tag)
+	}
+	return nil
+}
+
+// Len returns the number of entries, expired ones included until touched.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	item := s.ll.Remove(el).(*memoryItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+	for _, tag := range item.tags {
+		delete(s.tags[tag], item.key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
+
+// RedisStore shares entries between instances through a server speaking the
+// Redis protocol. Tags are sets of keys expiring with their longest entry.
+type RedisStore struct {
+	client *resp.Client
+	prefix string
+}
+
+func NewRedisStore(client *resp.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	b, err := resp.Bytes(s.client.Do(ctx, "GET", s.prefix+key))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, e *Entry, tags []string) error {
+	ttl := time.Until(e.expires()).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.Do(ctx, "SET", s.prefix+key, b, "PX", ttl); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tagKey := s.prefix + "tag:" + tag
+		if _, err := s.client.Do(ctx, "SADD", tagKey, key); err != nil {
+			return err
+		}
+		// only ever extend, the set must outlive every entry in it
+		current, err := resp.Int(s.client.Do(ctx, "PTTL", tagKey))
+		if err != nil {
+			return err
+		}
+		// -1 (no expiry yet) is below any ttl too
+		if current < ttl {
+			if _, err := s.client.Do(ctx, "PEXPIRE", tagKey, ttl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RedisStore) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		tagKey := s.prefix + "tag:" + tag
+		keys, err := resp.Strings(s.client.Do(ctx, "SMEMBERS", tagKey))
+		if err != nil {
+			return err
+		}
+		args := []any{"DEL", tagKey}
+		for _, key := range keys {
+			args = append(args, s.prefix+key)
+		}
+		if _, err := s.client.Do(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mwdev22/rest/middleware"
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// Record is what a Store keeps per key. Done is false while the first
+// request is still being served.
+type Record struct {
+	Fingerprint string
+	Done        bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+type Store interface {
+	// Reserve creates an in-flight record for key that expires after ttl.
+	// When the key is already taken the existing record is returned instead
+	// and nothing is changed.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (existing *Record, err error)
+	// Complete stores the response of a reserved key and keeps it for ttl.
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type Options struct {
+	// TTL of stored responses, 24h by default.
+	TTL time.Duration
+	// LockTTL bounds an in-flight reservation, one minute by default. A key
+	// left behind by a crashed process is free again after it, so keep it
+	// above the slowest handler.
+	LockTTL time.Duration
+	// Methods the key is honoured for, POST and PATCH by default.
+	Methods []string
+	// Required rejects requests without a key with 400.
+	Required bool
+	// MaxBody caps the request body read for the fingerprint, 1 MiB by default.
+	MaxBody int64
+	// MaxResponse caps a stored response, bigger ones are served but not kept.
+	MaxResponse int
+	// Scope namespaces keys, by default per method and path. Include the
+	// caller's identity when keys from different users may collide.
+	Scope func(r *http.Request) string
+}
+
+func (o *Options) setDefaults() {
+	if o.TTL <= 0 {
+		o.TTL = 24 * time.Hour
+	}
+	if o.LockTTL <= 0 {
+		o.LockTTL = time.Minute
+	}
+	if len(o.Methods) == 0 {
+		o.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+	if o.MaxResponse <= 0 {
+		o.MaxResponse = 1 << 20
+	}
+	if o.Scope == nil {
+		o.Scope = func(r *http.Request) string { return r.Method + " " + r.URL.Path }
+	}
+}
+
+// Middleware makes retried requests carrying the same Idempotency-Key
+// return the first response instead of running the handler again. Responses
+// with a 5xx status are not stored, so those can be retried for real.
+func Middleware(store Store, opts Options) func(next http.Handler) http.Handler {
+	opts.setDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(Header)
+			if key == "" {
+				if opts.Required {
+					middleware.RenderError(w, r, errs.NewApiError(http.StatusBadRequest, "missing idempotency key"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				middleware.RenderError(w, r, errs.NewApiError(http.StatusBadRequest, "invalid idempotency key"))
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBody+1))
+			r.Body.Close()
+			if err != nil {
+				middleware.RenderError(w, r, errs.InternalServerError(err))
+				return
+			}
+			if int64(len(body)) > opts.MaxBody {
+				middleware.RenderError(w, r, errs.RequestTooLarge(opts.MaxBody))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scoped := opts.Scope(r) + " " + key
+			fp := fingerprint(r, body)
+			existing, err := store.Reserve(r.Context(), scoped, fp, opts.LockTTL)
+			if err != nil {
+				middleware.RenderError(w, r, errs.InternalServerError(fmt.Errorf("idempotency reserve: %w", err)))
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fp:
+					middleware.RenderError(w, r, errs.NewApiError(http.StatusUnprocessableEntity, "idempotency key reused with a different request"))
+				case !existing.Done:
+					middleware.RenderError(w, r, errs.Conflict("request with idempotency key "+key+" is still in progress"))
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, limit: opts.MaxResponse}
+			stored := false
+			defer func() {
+				if stored {
+					return
+				}
+				// the handler failed or panicked, let the client retry
+				if err := store.Release(context.WithoutCancel(r.Context()), scoped); err != nil {
+					log.Printf("idempotency: release %q: %v", key, err)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= 500 || rec.overflow {
+				return
+			}
+			err = store.Complete(context.WithoutCancel(r.Context()), scoped, Record{
+				Fingerprint: fp,
+				Done:        true,
+				Status:      status,
+				Header:      rec.header,
+				Body:        rec.body.Bytes(),
+			}, opts.TTL)
+			if err != nil {
+				log.Printf("idempotency: complete %q: %v", key, err)
+				return
+			}
+			stored = true
+		})
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	for k, v := range rec.Header {
+		w.Header()[k] = slices.Clone(v)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recorder passes the response through while keeping a copy.
+type recorder struct {
+	http.ResponseWriter
+	limit    int
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > rec.limit {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
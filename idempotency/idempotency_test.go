@@ -0,0 +1,219 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/query"
+	_ "modernc.org/sqlite"
+)
+
+func sqliteStore(t *testing.T) Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE idempotency_keys (
+		id          VARCHAR(767) PRIMARY KEY,
+		fingerprint VARCHAR(64)  NOT NULL,
+		done        BOOLEAN      NOT NULL DEFAULT FALSE,
+		status      INTEGER      NOT NULL DEFAULT 0,
+		header      TEXT         NOT NULL DEFAULT '',
+		body        BLOB,
+		expires_at  BIGINT       NOT NULL
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(db, "idempotency_keys", query.Question)
+}
+
+var stores = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store { return NewMemoryStore() },
+	"sqlite": sqliteStore,
+}
+
+func send(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func errorMsg(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return response["error"]
+}
+
+func TestReplay(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := Middleware(newStore(t), Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.Header().Set("Location", "/orders/1")
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"id":1,"call":%d}`, n)
+			}))
+
+			first := send(h, "k1", `{"item":"book"}`)
+			second := send(h, "k1", `{"item":"book"}`)
+
+			if calls.Load() != 1 {
+				t.Errorf("expected handler to run once, got %d", calls.Load())
+			}
+			if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+				t.Errorf("expected replay of %d %s, got %d %s", first.Code, first.Body, second.Code, second.Body)
+			}
+			if second.Header().Get("Location") != "/orders/1" || second.Header().Get(ReplayedHeader) != "true" {
+				t.Errorf("unexpected replay headers %v", second.Header())
+			}
+			if first.Header().Get(ReplayedHeader) != "" {
+				t.Error("first response must not be marked as replayed")
+			}
+
+			send(h, "k2", `{"item":"book"}`)
+			send(h, "", `{"item":"book"}`)
+			if calls.Load() != 3 {
+				t.Errorf("expected new key and missing key to run the handler, got %d calls", calls.Load())
+			}
+		})
+	}
+}
+
+func TestMismatchAndInFlight(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			entered, release := make(chan struct{}), make(chan struct{})
+			h := Middleware(newStore(t), Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(entered)
+				<-release
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- send(h, "k1", `{"item":"book"}`) }()
+			<-entered
+
+			w := send(h, "k1", `{"item":"book"}`)
+			if w.Code != http.StatusConflict {
+				t.Errorf("expected status 409 while in flight, got %d", w.Code)
+			}
+
+			close(release)
+			if first := <-done; first.Code != http.StatusCreated {
+				t.Errorf("expected first request to succeed, got %d", first.Code)
+			}
+
+			w = send(h, "k1", `{"item":"pen"}`)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("expected status 422 for different body, got %d", w.Code)
+			}
+			if msg := errorMsg(t, w); msg != "idempotency key reused with a different request" {
+				t.Errorf("unexpected error message '%s'", msg)
+			}
+		})
+	}
+}
+
+func TestServerErrorNotStored(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := Middleware(newStore(t), Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			send(h, "k1", `{}`)
+			w := send(h, "k1", `{}`)
+
+			if w.Code != http.StatusCreated || calls.Load() != 2 {
+				t.Errorf("expected retry after 5xx to run the handler, got %d after %d calls", w.Code, calls.Load())
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	h := Middleware(NewMemoryStore(), Options{Required: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := send(h, "", `{}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without key, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected safe methods to pass through, got %d", w.Code)
+	}
+}
+
+func TestReleaseAfterPanic(t *testing.T) {
+	store := NewMemoryStore()
+	h := Middleware(store, Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		send(h, "k1", `{}`)
+	}()
+
+	if rec, _ := store.Reserve(context.Background(), "POST /orders k1", "fp", 0); rec != nil {
+		t.Errorf("expected key to be released after panic, got %+v", rec)
+	}
+}
+
+func TestLockTTL(t *testing.T) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			// a process that crashed mid-handler never completes its key
+			if rec, err := store.Reserve(ctx, "crashed", "fp", 20*time.Millisecond); rec != nil || err != nil {
+				t.Fatalf("expected reservation, got %+v %v", rec, err)
+			}
+			if rec, _ := store.Reserve(ctx, "crashed", "fp", 20*time.Millisecond); rec == nil || rec.Done {
+				t.Fatalf("expected in-flight record, got %+v", rec)
+			}
+			time.Sleep(30 * time.Millisecond)
+			if rec, err := store.Reserve(ctx, "crashed", "fp", 20*time.Millisecond); rec != nil || err != nil {
+				t.Errorf("expected the lock to expire, got %+v %v", rec, err)
+			}
+
+			// completing extends the short lock to the response TTL
+			store.Reserve(ctx, "done", "fp", 20*time.Millisecond)
+			if err := store.Complete(ctx, "done", Record{Fingerprint: "fp", Done: true, Status: http.StatusCreated}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(30 * time.Millisecond)
+			if rec, _ := store.Reserve(ctx, "done", "fp", 20*time.Millisecond); rec == nil || !rec.Done || rec.Status != http.StatusCreated {
+				t.Errorf("expected stored response to outlive the lock, got %+v", rec)
+			}
+		})
+	}
+}
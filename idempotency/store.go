@@ -0,0 +1,165 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mwdev22/rest/db"
+	"github.com/mwdev22/rest/query"
+)
+
+var ErrNotReserved = errors.New("idempotency: key is not reserved")
+
+type memoryEntry struct {
+	rec     Record
+	expires time.Time
+}
+
+// MemoryStore keeps records in process, fine for a single instance and tests.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		rec := e.rec
+		return &rec, nil
+	}
+	s.entries[key] = &memoryEntry{rec: Record{Fingerprint: fingerprint}, expires: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return ErrNotReserved
+	}
+	e.rec = rec
+	e.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// SQLStore keeps records in a table shared by all instances:
+//
+//	CREATE TABLE idempotency_keys (
+//		id          VARCHAR(767) PRIMARY KEY,
+//		fingerprint VARCHAR(64)  NOT NULL,
+//		done        BOOLEAN      NOT NULL DEFAULT FALSE,
+//		status      INTEGER      NOT NULL DEFAULT 0,
+//		header      TEXT         NOT NULL DEFAULT '',
+//		body        BLOB,  -- BYTEA on PostgreSQL
+//		expires_at  BIGINT       NOT NULL
+//	);
+//
+// Reserve detects a taken key from the primary key violation, which works on
+// PostgreSQL, MySQL and SQLite alike.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	ph    query.Placeholder
+}
+
+func NewSQLStore(db *sql.DB, table string, ph query.Placeholder) *SQLStore {
+	return &SQLStore{db: db, table: table, ph: ph}
+}
+
+func (s *SQLStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE id = %s AND expires_at < %s", s.table, s.ph(1), s.ph(2)),
+		key, now.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (id, fingerprint, expires_at) VALUES (%s, %s, %s)",
+			s.table, s.ph(1), s.ph(2), s.ph(3)),
+		key, fingerprint, now.Add(ttl).UnixNano())
+	if err == nil {
+		return nil, nil
+	}
+	if !db.IsUniqueViolation(err) {
+		return nil, err
+	}
+
+	var rec Record
+	var header string
+	err = s.db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT fingerprint, done, status, header, body FROM %s WHERE id = %s", s.table, s.ph(1)),
+		key).Scan(&rec.Fingerprint, &rec.Done, &rec.Status, &header, &rec.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released between our insert and select, report it as in flight
+		return &Record{Fingerprint: fingerprint}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header != "" {
+		if err := json.Unmarshal([]byte(header), &rec.Header); err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+func (s *SQLStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET done = %s, status = %s, header = %s, body = %s, expires_at = %s WHERE id = %s",
+			s.table, s.ph(1), s.ph(2), s.ph(3), s.ph(4), s.ph(5), s.ph(6)),
+		true, rec.Status, string(header), rec.Body, time.Now().Add(ttl).UnixNano(), key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE id = %s AND done = %s", s.table, s.ph(1), s.ph(2)),
+		key, false)
+	return err
+}
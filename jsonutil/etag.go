@@ -0,0 +1,119 @@
+package jsonutil
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// StrongETag hashes the exact bytes of a representation.
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag hashes a body that may be re-serialized differently while meaning
+// the same thing.
+func WeakETag(body []byte) string {
+	return "W/" + StrongETag(body)
+}
+
+// VersionETag turns a resource version (row version, updated_at, ...) into an
+// ETag so handlers can skip hashing. The version must not contain quotes.
+func VersionETag(version any) string {
+	return `"` + fmt.Sprint(version) + `"`
+}
+
+// EncodedETag derives the tag of a content-coded representation, "abc"
+// becomes "abc+gzip". Unlike W/ it keeps the validator strong, so clients can
+// send it back in If-Match, and the matchers accept it for the unencoded tag.
+func EncodedETag(etag, coding string) string {
+	if len(etag) < 2 || etag[len(etag)-1] != '"' {
+		return etag
+	}
+	return etag[:len(etag)-1] + "+" + strings.ToLower(coding) + `"`
+}
+
+// unencoded strips the coding added by EncodedETag, if any.
+func unencoded(tag string) string {
+	i := strings.LastIndexByte(tag, '+')
+	if i < 0 || i+2 >= len(tag) {
+		return tag
+	}
+	for _, c := range tag[i+1 : len(tag)-1] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return tag
+		}
+	}
+	return tag[:i] + `"`
+}
+
+// MatchETag reports whether etag is listed in an If-None-Match header value,
+// "*" matches any existing resource. Comparison is weak, W/ is ignored on
+// both sides.
+func MatchETag(header, etag string) bool {
+	return matchETag(header, etag, false)
+}
+
+// MatchETagStrong is the strong comparison If-Match requires (RFC 9110
+// 13.1.1): weak tags in header never match. etag is the server's own,
+// unencoded tag and is compared without its W/ prefix.
+func MatchETagStrong(header, etag string) bool {
+	return matchETag(header, etag, true)
+}
+
+func matchETag(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	opaque := strings.TrimPrefix(etag, "W/")
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+		if header[0] == '*' {
+			return true
+		}
+		tag, weak := strings.CutPrefix(header, "W/")
+		if tag == "" || tag[0] != '"' {
+			return false
+		}
+		end := strings.IndexByte(tag[1:], '"')
+		if end < 0 {
+			return false
+		}
+		if t := tag[:end+2]; !(strong && weak) && (t == opaque || unencoded(t) == opaque) {
+			return true
+		}
+		header = tag[end+2:]
+	}
+	return false
+}
+
+// CheckIfMatch guards PUT, PATCH and DELETE handlers against lost updates.
+// current is the ETag of the stored resource, "" if it doesn't exist. Requests
+// without If-Match pass, others need a strong match.
+func CheckIfMatch(r *http.Request, current string) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	if !MatchETagStrong(header, current) {
+		return errs.PreconditionFailed(fmt.Sprintf("If-Match %s, current %s", header, current))
+	}
+	return nil
+}
+
+// RequireIfMatch is CheckIfMatch for endpoints that refuse blind overwrites
+// with 428.
+func RequireIfMatch(r *http.Request, current string) error {
+	if r.Header.Get("If-Match") == "" {
+		return errs.PreconditionRequired("If-Match")
+	}
+	return CheckIfMatch(r, current)
+}
@@ -0,0 +1,131 @@
+package jsonutil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		etag     string
+		expected bool
+	}{
+		{name: "exact", header: `"abc"`, etag: `"abc"`, expected: true},
+		{name: "list", header: `"x", "abc"`, etag: `"abc"`, expected: true},
+		{name: "weak header", header: `W/"abc"`, etag: `"abc"`, expected: true},
+		{name: "weak etag", header: `"abc"`, etag: `W/"abc"`, expected: true},
+		{name: "comma in tag", header: `"a,b"`, etag: `"a,b"`, expected: true},
+		{name: "wildcard", header: `*`, etag: `"abc"`, expected: true},
+		{name: "wildcard without resource", header: `*`, etag: ``},
+		{name: "different", header: `"x", "y"`, etag: `"abc"`},
+		{name: "unquoted", header: `abc`, etag: `"abc"`},
+		{name: "empty header", header: ``, etag: `"abc"`},
+		{name: "encoded", header: `"abc+gzip"`, etag: `"abc"`, expected: true},
+		{name: "encoded weak", header: `W/"abc+br"`, etag: `"abc"`, expected: true},
+		{name: "plus in version", header: `"2024-01-01T00:00:00+02:00"`, etag: `"2024-01-01T00:00:00"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchETag(tt.header, tt.etag); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatchETagStrong(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		etag     string
+		expected bool
+	}{
+		{name: "exact", header: `"abc"`, etag: `"abc"`, expected: true},
+		{name: "list", header: `W/"x", "abc"`, etag: `"abc"`, expected: true},
+		{name: "weak header", header: `W/"abc"`, etag: `"abc"`},
+		{name: "weakened current", header: `"abc"`, etag: `W/"abc"`, expected: true},
+		{name: "encoded", header: `"abc+gzip"`, etag: `"abc"`, expected: true},
+		{name: "encoded weak", header: `W/"abc+gzip"`, etag: `"abc"`},
+		{name: "wildcard", header: `*`, etag: `"abc"`, expected: true},
+		{name: "different", header: `"abd"`, etag: `"abc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchETagStrong(tt.header, tt.etag); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestETags(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	if StrongETag(body) != StrongETag([]byte(`{"id":1}`)) || StrongETag(body) == StrongETag([]byte(`{"id":2}`)) {
+		t.Error("expected ETag to depend only on the body")
+	}
+	if WeakETag(body) != "W/"+StrongETag(body) {
+		t.Errorf("unexpected weak ETag %s", WeakETag(body))
+	}
+	if got := EncodedETag(`"abc"`, "GZIP"); got != `"abc+gzip"` {
+		t.Errorf("expected '\"abc+gzip\"', got '%s'", got)
+	}
+	if got := EncodedETag(`W/"abc"`, "br"); got != `W/"abc+br"` {
+		t.Errorf("expected 'W/\"abc+br\"', got '%s'", got)
+	}
+	if VersionETag(7) != `"7"` {
+		t.Errorf("expected '\"7\"', got '%s'", VersionETag(7))
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		ifMatch        string
+		current        string
+		require        bool
+		expectedStatus int
+	}{
+		{name: "no header", current: `"1"`},
+		{name: "match", ifMatch: `"1"`, current: `"1"`},
+		{name: "weak tag", ifMatch: `W/"1"`, current: `"1"`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "compressed tag", ifMatch: `"1+gzip"`, current: `"1"`},
+		{name: "stale", ifMatch: `"1"`, current: `"2"`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "missing resource", ifMatch: `*`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "required", current: `"1"`, require: true, expectedStatus: http.StatusPreconditionRequired},
+		{name: "required match", ifMatch: `"1"`, current: `"1"`, require: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/items/1", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			check := CheckIfMatch
+			if tt.require {
+				check = RequireIfMatch
+			}
+			err := check(req, tt.current)
+
+			if tt.expectedStatus == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			var apiErr errs.ApiError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %v", tt.expectedStatus, err)
+			}
+		})
+	}
+}
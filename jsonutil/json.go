@@ -1,6 +1,7 @@
 package jsonutil
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
@@ -9,6 +10,11 @@ import (
 
 var Validate = validator.New()
 
+// StructValidator is satisfied by both *validator.Validate and *validation.Validator.
+type StructValidator interface {
+	StructCtx(ctx context.Context, s any) error
+}
+
 func Write(w http.ResponseWriter, status int, body any) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -19,11 +25,15 @@ func Write(w http.ResponseWriter, status int, body any) error {
 }
 
 func Parse(r *http.Request, payload any) error {
+	return ParseWith(r, payload, Validate)
+}
+
+func ParseWith(r *http.Request, payload any, v StructValidator) error {
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
 		return err
 	}
-	if err := Validate.Struct(payload); err != nil {
+	if err := v.StructCtx(r.Context(), payload); err != nil {
 		return err
 	}
 	return nil
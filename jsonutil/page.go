@@ -0,0 +1,191 @@
+package jsonutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+const (
+	defaultPageLimit = 20
+	defaultMaxLimit  = 100
+)
+
+type PageOptions struct {
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type Page struct {
+	Limit  int
+	Offset int
+	// Cursor is the raw opaque cursor, decode it with CursorCodec.Decode.
+	Cursor string
+}
+
+// ParsePage reads limit, offset and cursor query params. A limit above
+// MaxLimit is an error rather than silently clamped so clients notice.
+func ParsePage(r *http.Request, opts PageOptions) (Page, error) {
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = defaultPageLimit
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = defaultMaxLimit
+	}
+
+	q := r.URL.Query()
+	p := Page{Limit: opts.DefaultLimit, Cursor: q.Get("cursor")}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > opts.MaxLimit {
+			return Page{}, errs.InvalidQueryParam("limit")
+		}
+		p.Limit = limit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return Page{}, errs.InvalidQueryParam("offset")
+		}
+		p.Offset = offset
+	}
+	if p.Cursor != "" && q.Has("offset") {
+		return Page{}, errs.InvalidQueryParam("cursor")
+	}
+	return p, nil
+}
+
+// CursorCodec turns sort keys into opaque cursors. With a secret the cursor
+// carries an HMAC so clients cannot forge positions.
+type CursorCodec struct {
+	secret []byte
+}
+
+func NewCursorCodec(secret []byte) CursorCodec {
+	return CursorCodec{secret: secret}
+}
+
+func (c CursorCodec) Encode(keys any) (string, error) {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return "", err
+	}
+	cursor := base64.RawURLEncoding.EncodeToString(b)
+	if c.secret != nil {
+		cursor += "." + base64.RawURLEncoding.EncodeToString(c.sign(b))
+	}
+	return cursor, nil
+}
+
+func (c CursorCodec) Decode(cursor string, keys any) error {
+	payload, sig, signed := strings.Cut(cursor, ".")
+	if signed != (c.secret != nil) {
+		return errs.InvalidQueryParam("cursor")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return errs.InvalidQueryParam("cursor")
+	}
+	if c.secret != nil {
+		got, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil || !hmac.Equal(got, c.sign(b)) {
+			return errs.InvalidQueryParam("cursor")
+		}
+	}
+	if err := json.Unmarshal(b, keys); err != nil {
+		return errs.InvalidQueryParam("cursor")
+	}
+	return nil
+}
+
+func (c CursorCodec) sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type Envelope[T any] struct {
+	Data []T  `json:"data"`
+	Meta Meta `json:"meta"`
+}
+
+// OffsetMeta builds the meta of an offset page, total < 0 means unknown.
+func OffsetMeta(p Page, total int64) Meta {
+	m := Meta{Limit: p.Limit, Offset: &p.Offset}
+	if total >= 0 {
+		m.Total = &total
+	}
+	return m
+}
+
+// WritePage writes the data/meta envelope and RFC 8288 Link headers pointing
+// at the first, previous and next pages of the current request URL.
+func WritePage[T any](w http.ResponseWriter, r *http.Request, data []T, meta Meta) error {
+	if data == nil {
+		data = []T{}
+	}
+
+	var links []string
+	link := func(rel string, set map[string]string, del ...string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(r.URL, set, del...), rel))
+	}
+
+	limit := strconv.Itoa(meta.Limit)
+	switch {
+	case meta.Offset != nil:
+		offset := *meta.Offset
+		link("first", map[string]string{"limit": limit, "offset": "0"}, "cursor")
+		if offset > 0 {
+			prev := max(offset-meta.Limit, 0)
+			link("prev", map[string]string{"limit": limit, "offset": strconv.Itoa(prev)}, "cursor")
+		}
+		hasNext := len(data) == meta.Limit
+		if meta.Total != nil {
+			hasNext = int64(offset+meta.Limit) < *meta.Total
+		}
+		if hasNext {
+			link("next", map[string]string{"limit": limit, "offset": strconv.Itoa(offset + meta.Limit)}, "cursor")
+		}
+	default:
+		link("first", map[string]string{"limit": limit}, "cursor", "offset")
+		if meta.PrevCursor != "" {
+			link("prev", map[string]string{"limit": limit, "cursor": meta.PrevCursor}, "offset")
+		}
+		if meta.NextCursor != "" {
+			link("next", map[string]string{"limit": limit, "cursor": meta.NextCursor}, "offset")
+		}
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	return Write(w, http.StatusOK, Envelope[T]{Data: data, Meta: meta})
+}
+
+func pageURL(u *url.URL, set map[string]string, del ...string) string {
+	q := u.Query()
+	for _, k := range del {
+		q.Del(k)
+	}
+	for k, v := range set {
+		q.Set(k, v)
+	}
+	next := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return next.String()
+}
@@ -0,0 +1,208 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expected      Page
+		expectedError string
+	}{
+		{
+			name:     "defaults",
+			query:    "",
+			expected: Page{Limit: 20},
+		},
+		{
+			name:     "limit and offset",
+			query:    "limit=50&offset=100",
+			expected: Page{Limit: 50, Offset: 100},
+		},
+		{
+			name:     "cursor",
+			query:    "limit=10&cursor=abc",
+			expected: Page{Limit: 10, Cursor: "abc"},
+		},
+		{
+			name:          "limit above max",
+			query:         "limit=101",
+			expectedError: "invalid query param: limit",
+		},
+		{
+			name:          "zero limit",
+			query:         "limit=0",
+			expectedError: "invalid query param: limit",
+		},
+		{
+			name:          "negative offset",
+			query:         "offset=-1",
+			expectedError: "invalid query param: offset",
+		},
+		{
+			name:          "cursor and offset together",
+			query:         "offset=10&cursor=abc",
+			expectedError: "invalid query param: cursor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items?"+tt.query, nil)
+			p, err := ParsePage(req, PageOptions{})
+
+			if tt.expectedError != "" {
+				var e errs.ApiError
+				if !errors.As(err, &e) || e.Msg != tt.expectedError {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, p)
+			}
+		})
+	}
+}
+
+func TestCursorCodec(t *testing.T) {
+	type key struct {
+		CreatedAt string `json:"c"`
+		ID        int    `json:"i"`
+	}
+
+	signed := NewCursorCodec([]byte("secret"))
+	cursor, err := signed.Encode(key{CreatedAt: "2026-01-01", ID: 7})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got key
+	if err := signed.Decode(cursor, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != 7 || got.CreatedAt != "2026-01-01" {
+		t.Errorf("unexpected keys: %+v", got)
+	}
+
+	tampered := "eyJjIjoiMjAyNi0wMS0wMSIsImkiOjh9" + cursor[strings.Index(cursor, "."):]
+	tests := []struct {
+		name   string
+		codec  CursorCodec
+		cursor string
+	}{
+		{"tampered payload", signed, tampered},
+		{"wrong secret", NewCursorCodec([]byte("other")), cursor},
+		{"unsigned cursor for signed codec", signed, cursor[:strings.Index(cursor, ".")]},
+		{"garbage", signed, "!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var k key
+			err := tt.codec.Decode(tt.cursor, &k)
+			var e errs.ApiError
+			if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected 400 ApiError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWritePage(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		data          []int
+		meta          func(p Page) Meta
+		expectedLinks string
+	}{
+		{
+			name:  "offset first page",
+			query: "status=active&limit=2",
+			data:  []int{1, 2},
+			meta: func(p Page) Meta {
+				return OffsetMeta(p, 5)
+			},
+			expectedLinks: `</items?limit=2&offset=0&status=active>; rel="first", </items?limit=2&offset=2&status=active>; rel="next"`,
+		},
+		{
+			name:  "offset last page",
+			query: "limit=2&offset=4",
+			data:  []int{5},
+			meta: func(p Page) Meta {
+				return OffsetMeta(p, 5)
+			},
+			expectedLinks: `</items?limit=2&offset=0>; rel="first", </items?limit=2&offset=2>; rel="prev"`,
+		},
+		{
+			name:  "offset unknown total",
+			query: "limit=2&offset=2",
+			data:  []int{3, 4},
+			meta: func(p Page) Meta {
+				return OffsetMeta(p, -1)
+			},
+			expectedLinks: `</items?limit=2&offset=0>; rel="first", </items?limit=2&offset=0>; rel="prev", </items?limit=2&offset=4>; rel="next"`,
+		},
+		{
+			name:  "cursor",
+			query: "limit=2&cursor=c1",
+			data:  []int{3, 4},
+			meta: func(p Page) Meta {
+				return Meta{Limit: p.Limit, NextCursor: "c2", PrevCursor: "c0"}
+			},
+			expectedLinks: `</items?limit=2>; rel="first", </items?cursor=c0&limit=2>; rel="prev", </items?cursor=c2&limit=2>; rel="next"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/items?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			p, err := ParsePage(req, PageOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := WritePage(w, req, tt.data, tt.meta(p)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := w.Header().Get("Link"); got != tt.expectedLinks {
+				t.Errorf("expected links\n%s\ngot\n%s", tt.expectedLinks, got)
+			}
+
+			var env Envelope[int]
+			if err := json.NewDecoder(w.Body).Decode(&env); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(env.Data) != len(tt.data) || env.Meta.Limit != p.Limit {
+				t.Errorf("unexpected envelope: %+v", env)
+			}
+		})
+	}
+}
+
+func TestWritePageEmptyData(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	w := httptest.NewRecorder()
+
+	if err := WritePage[string](w, req, nil, Meta{Limit: 20}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(w.Body.String(), `{"data":[],`) {
+		t.Errorf("expected empty data array, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,668 @@
+package jsonutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var errPathNotFound = errors.New("path not found")
+
+// ParsePatch applies the request body onto target as a merge patch (RFC 7396)
+// or a JSON Patch (RFC 6902) depending on the Content-Type.
+//
+// allow lists the JSON Pointers that may be modified, a pointer also allows
+// everything below it. No allow entries means every field is patchable.
+// Target is only modified when the patch applies and the result validates.
+func ParsePatch[T any](r *http.Request, target *T, allow ...string) error {
+	return ParsePatchWith(r, target, Validate, allow...)
+}
+
+// ParsePatchWith is ParsePatch validating the result with v instead of the
+// package global.
+func ParsePatchWith[T any](r *http.Request, target *T, v StructValidator, allow ...string) error {
+	defer r.Body.Close()
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errs.InvalidJson(err)
+	}
+
+	switch ct {
+	case MergePatchContentType:
+		return MergePatchWith(r.Context(), target, body, v, allow...)
+	case JSONPatchContentType:
+		return JSONPatchWith(r.Context(), target, body, v, allow...)
+	default:
+		return errs.UnsupportedMediaType(ct)
+	}
+}
+
+func MergePatch[T any](target *T, patch []byte, allow ...string) error {
+	return MergePatchWith(context.Background(), target, patch, Validate, allow...)
+}
+
+func MergePatchWith[T any](ctx context.Context, target *T, patch []byte, v StructValidator, allow ...string) error {
+	var p any
+	if err := decodeDocument(patch, &p); err != nil {
+		return errs.InvalidPatch(err)
+	}
+	if err := checkMergePaths(p, "", allow); err != nil {
+		return err
+	}
+
+	doc, err := toDocument(target)
+	if err != nil {
+		return errs.InternalServerError(err)
+	}
+	return fromDocument(ctx, target, mergePatch(doc, p), v)
+}
+
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func JSONPatch[T any](target *T, patch []byte, allow ...string) error {
+	return JSONPatchWith(context.Background(), target, patch, Validate, allow...)
+}
+
+func JSONPatchWith[T any](ctx context.Context, target *T, patch []byte, v StructValidator, allow ...string) error {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return errs.InvalidPatch(err)
+	}
+
+	doc, err := toDocument(target)
+	if err != nil {
+		return errs.InternalServerError(err)
+	}
+
+	for i, op := range ops {
+		doc, err = applyOperation(doc, op, allow)
+		if err != nil {
+			var e errs.ApiError
+			if errors.As(err, &e) {
+				return e
+			}
+			return errs.Conflict(fmt.Sprintf("patch operation %d (%s %s): %v", i, op.Op, op.Path, err))
+		}
+	}
+	return fromDocument(ctx, target, doc, v)
+}
+
+func applyOperation(doc any, op Operation, allow []string) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, errs.InvalidPatch(err)
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errs.InvalidPatch(fmt.Errorf("%s operation requires a value", op.Op))
+		}
+		if err := decodeDocument(op.Value, &value); err != nil {
+			return nil, errs.InvalidPatch(err)
+		}
+	}
+
+	var from []string
+	switch op.Op {
+	case "move", "copy":
+		if from, err = parsePointer(op.From); err != nil {
+			return nil, errs.InvalidPatch(err)
+		}
+	}
+
+	switch op.Op {
+	case "add", "remove", "replace", "copy":
+		if !pathAllowed(op.Path, allow) {
+			return nil, errs.FieldNotPatchable(op.Path)
+		}
+	case "move":
+		if !pathAllowed(op.Path, allow) {
+			return nil, errs.FieldNotPatchable(op.Path)
+		}
+		if !pathAllowed(op.From, allow) {
+			return nil, errs.FieldNotPatchable(op.From)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+	case "remove":
+		if len(path) == 0 {
+			return nil, errs.NewApiError(http.StatusUnprocessableEntity, "cannot remove the whole document")
+		}
+		return removeValue(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			// the empty pointer is the whole document (RFC 6901)
+			return value, nil
+		}
+		if _, err := getValue(doc, path); err != nil {
+			return nil, err
+		}
+		if doc, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errs.InvalidPatch(fmt.Errorf("cannot move %s into its own child %s", op.From, op.Path))
+		}
+		v, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = removeValue(doc, from); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, v)
+	case "copy":
+		v, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = deepCopy(v); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, v)
+	case "test":
+		v, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, value) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, errs.InvalidPatch(fmt.Errorf("unknown operation %q", op.Op))
+	}
+}
+
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("invalid json pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func escapePointerToken(t string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(t)
+}
+
+func pathAllowed(path string, allow []string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	for _, a := range allow {
+		if a == "" || path == a || strings.HasPrefix(path, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func getValue(doc any, path []string) (any, error) {
+	node := doc
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			node = v
+		case []any:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// updateParent walks to the container holding the last token and replaces it
+// with whatever fn returns, arrays may change length so the result is stored
+// back in their own parent.
+func updateParent(node any, path []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	child, err := getValue(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateParent(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		n[path[0]] = child
+	case []any:
+		i, _ := arrayIndex(path[0], len(n)-1)
+		n[i] = child
+	}
+	return node, nil
+}
+
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, errPathNotFound
+		}
+	})
+}
+
+func removeValue(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return updateParent(doc, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, errPathNotFound
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, errPathNotFound
+		}
+	})
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+func checkMergePaths(patch any, prefix string, allow []string) error {
+	if pathAllowed(prefix, allow) {
+		return nil
+	}
+	p, ok := patch.(map[string]any)
+	if !ok || (len(p) == 0 && prefix != "") {
+		// an empty object still replaces a non-object value
+		if prefix == "" {
+			return errs.FieldNotPatchable("/")
+		}
+		return errs.FieldNotPatchable(prefix)
+	}
+	for k, v := range p {
+		if err := checkMergePaths(v, prefix+"/"+escapePointerToken(k), allow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonEqual(a, b any) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := new(big.Rat).SetString(av.String())
+		br, bok := new(big.Rat).SetString(bv.String())
+		return aok && bok && ar.Cmp(br) == 0
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok || !jsonEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func deepCopy(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	return out, decodeDocument(b, &out)
+}
+
+func decodeDocument(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after json document")
+	}
+	return nil
+}
+
+// toDocument turns v into a generic JSON document. Fields left out by
+// omitempty are filled in with their empty value, so a patch can address
+// them, e.g. append to a nil slice or replace a nil pointer.
+func toDocument(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := decodeDocument(b, &doc); err != nil {
+		return nil, err
+	}
+	if err := fillOmitted(doc, reflect.TypeOf(v)); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+type jsonField struct {
+	name      string
+	omitEmpty bool
+	typ       reflect.Type
+}
+
+// jsonFields lists the fields of struct type t the way encoding/json sees
+// them, with embedded structs promoted.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			// embedded pointers are left alone, filling them would allocate
+			if f.Type.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(f.Type)...)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, jsonField{name: name, omitEmpty: omitEmpty, typ: f.Type})
+	}
+	return fields
+}
+
+func fillOmitted(doc any, t reflect.Type) error {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+	switch d := doc.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			for _, f := range jsonFields(t) {
+				if _, ok := d[f.name]; !ok && f.omitEmpty {
+					v, err := emptyValue(f.typ)
+					if err != nil {
+						return err
+					}
+					d[f.name] = v
+				}
+				if err := fillOmitted(d[f.name], f.typ); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			for _, v := range d {
+				if err := fillOmitted(v, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, v := range d {
+				if err := fillOmitted(v, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// emptyValue is what an omitempty field of type t stands for when absent.
+// Slices and maps become empty collections rather than null so they can be
+// added to.
+func emptyValue(t reflect.Type) (any, error) {
+	switch {
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		return []any{}, nil
+	case t.Kind() == reflect.Map:
+		return map[string]any{}, nil
+	}
+	return toDocument(reflect.Zero(t).Interface())
+}
+
+// stripEmpty drops omitempty fields the patch left empty, so they decode to
+// their zero value (a nil slice rather than an empty one) as before.
+func stripEmpty(doc any, t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return
+	}
+	switch d := doc.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			for _, f := range jsonFields(t) {
+				v, ok := d[f.name]
+				if !ok {
+					continue
+				}
+				if f.omitEmpty && isEmptyJSON(v, f.typ) {
+					delete(d, f.name)
+					continue
+				}
+				stripEmpty(v, f.typ)
+			}
+		case reflect.Map:
+			for _, v := range d {
+				stripEmpty(v, t.Elem())
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, v := range d {
+				stripEmpty(v, t.Elem())
+			}
+		}
+	}
+}
+
+// isEmptyJSON mirrors encoding/json's omitempty rule for a value of type t.
+func isEmptyJSON(v any, t reflect.Type) bool {
+	if v == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		switch c := v.(type) {
+		case []any:
+			return len(c) == 0
+		case map[string]any:
+			return len(c) == 0
+		case string:
+			return c == ""
+		}
+	case reflect.String:
+		return v == ""
+	case reflect.Bool:
+		return v == false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return jsonEqual(v, json.Number("0"))
+	}
+	return false
+}
+
+// fromDocument decodes the patched document into a copy of target, fields
+// hidden from json (json:"-" or unexported) keep their current values.
+func fromDocument[T any](ctx context.Context, target *T, doc any, v StructValidator) error {
+	stripEmpty(doc, reflect.TypeOf(target))
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return errs.InternalServerError(err)
+	}
+
+	out := *target
+	resetJSONFields(reflect.ValueOf(&out).Elem())
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return errs.ValidationFailed(err)
+	}
+
+	if reflect.Indirect(reflect.ValueOf(out)).Kind() == reflect.Struct {
+		if err := v.StructCtx(ctx, out); err != nil {
+			return errs.ValidationFailed(err)
+		}
+	}
+
+	*target = out
+	return nil
+}
+
+func resetJSONFields(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		v.SetZero()
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+		v.Field(i).SetZero()
+	}
+}
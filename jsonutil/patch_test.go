@@ -0,0 +1,382 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type user struct {
+	ID      int      `json:"-"`
+	Name    string   `json:"name" validate:"required"`
+	Email   *string  `json:"email,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Address address  `json:"address"`
+	Version int      `json:"version"`
+}
+
+func newUser() user {
+	email := "a@example.com"
+	return user{
+		ID:      42,
+		Name:    "alice",
+		Email:   &email,
+		Tags:    []string{"a", "b"},
+		Address: address{City: "Warsaw", Zip: "00-001"},
+		Version: 3,
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		patch          string
+		allow          []string
+		expected       func(u *user)
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:  "replace field",
+			patch: `{"name":"bob"}`,
+			expected: func(u *user) {
+				u.Name = "bob"
+			},
+		},
+		{
+			name:  "null removes field",
+			patch: `{"email":null}`,
+			expected: func(u *user) {
+				u.Email = nil
+			},
+		},
+		{
+			name:  "nested merge keeps siblings",
+			patch: `{"address":{"zip":null}}`,
+			expected: func(u *user) {
+				u.Address.Zip = ""
+			},
+		},
+		{
+			name:  "allowed nested path",
+			patch: `{"address":{"city":"Krakow"}}`,
+			allow: []string{"/address/city", "/name"},
+			expected: func(u *user) {
+				u.Address.City = "Krakow"
+			},
+		},
+		{
+			name:           "path outside allowlist",
+			patch:          `{"version":4}`,
+			allow:          []string{"/name"},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "empty object outside allowlist",
+			patch:          `{"version":{}}`,
+			allow:          []string{"/name"},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "field is not patchable: /version",
+		},
+		{
+			name:           "merged result fails validation",
+			patch:          `{"name":null}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "unknown field",
+			patch:          `{"admin":true}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed patch",
+			patch:          `{"name":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUser()
+			err := MergePatch(&u, []byte(tt.patch), tt.allow...)
+
+			if tt.expectedStatus != 0 {
+				var e errs.ApiError
+				if !errors.As(err, &e) {
+					t.Fatalf("expected ApiError, got %v", err)
+				}
+				if e.StatusCode != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d", tt.expectedStatus, e.StatusCode)
+				}
+				if tt.expectedError != "" && e.Msg != tt.expectedError {
+					t.Errorf("expected error '%s', got '%s'", tt.expectedError, e.Msg)
+				}
+				if !reflect.DeepEqual(u, newUser()) {
+					t.Errorf("target modified on failed patch: %+v", u)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := newUser()
+			tt.expected(&want)
+			if !reflect.DeepEqual(u, want) {
+				t.Errorf("expected %+v, got %+v", want, u)
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		patch          string
+		allow          []string
+		initial        func(u *user)
+		expected       func(u *user)
+		expectedStatus int
+	}{
+		{
+			name:    "append to omitted slice",
+			patch:   `[{"op":"add","path":"/tags/-","value":"x"}]`,
+			initial: func(u *user) { u.Tags = nil },
+			expected: func(u *user) {
+				u.Tags = []string{"x"}
+			},
+		},
+		{
+			name:    "replace omitted pointer",
+			patch:   `[{"op":"replace","path":"/email","value":"b@x"}]`,
+			initial: func(u *user) { u.Email = nil },
+			expected: func(u *user) {
+				email := "b@x"
+				u.Email = &email
+			},
+		},
+		{
+			name:    "omitted fields stay nil",
+			patch:   `[{"op":"replace","path":"/name","value":"bob"}]`,
+			initial: func(u *user) { u.Email, u.Tags, u.Address.Zip = nil, nil, "" },
+			expected: func(u *user) {
+				u.Name = "bob"
+			},
+		},
+		{
+			name:  "replace and add",
+			patch: `[{"op":"replace","path":"/name","value":"bob"},{"op":"add","path":"/tags/-","value":"c"}]`,
+			expected: func(u *user) {
+				u.Name = "bob"
+				u.Tags = []string{"a", "b", "c"}
+			},
+		},
+		{
+			name:  "insert and remove array items",
+			patch: `[{"op":"add","path":"/tags/0","value":"z"},{"op":"remove","path":"/tags/2"}]`,
+			expected: func(u *user) {
+				u.Tags = []string{"z", "a"}
+			},
+		},
+		{
+			name:  "test then replace",
+			patch: `[{"op":"test","path":"/version","value":3.0},{"op":"replace","path":"/version","value":4}]`,
+			expected: func(u *user) {
+				u.Version = 4
+			},
+		},
+		{
+			name:  "move and copy",
+			patch: `[{"op":"copy","from":"/address/city","path":"/name"},{"op":"move","from":"/address/zip","path":"/address/city"}]`,
+			expected: func(u *user) {
+				u.Name = "Warsaw"
+				u.Address = address{City: "00-001"}
+			},
+		},
+		{
+			name:  "replace whole document",
+			patch: `[{"op":"replace","path":"","value":{"name":"bob","address":{"city":"Krakow"},"version":5}}]`,
+			expected: func(u *user) {
+				*u = user{ID: 42, Name: "bob", Address: address{City: "Krakow"}, Version: 5}
+			},
+		},
+		{
+			name:  "test and add whole document",
+			patch: `[{"op":"test","path":"","value":{"name":"alice","email":"a@example.com","tags":["a","b"],"address":{"city":"Warsaw","zip":"00-001"},"version":3}},{"op":"add","path":"","value":{"name":"bob","address":{"city":"Krakow"}}}]`,
+			expected: func(u *user) {
+				*u = user{ID: 42, Name: "bob", Address: address{City: "Krakow"}}
+			},
+		},
+		{
+			name:           "remove whole document",
+			patch:          `[{"op":"remove","path":""}]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "replace whole document outside allowlist",
+			patch:          `[{"op":"replace","path":"","value":{"name":"bob","address":{"city":"Krakow"}}}]`,
+			allow:          []string{"/name"},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "failed test is a conflict",
+			patch:          `[{"op":"test","path":"/version","value":2},{"op":"replace","path":"/version","value":4}]`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "remove missing path is a conflict",
+			patch:          `[{"op":"remove","path":"/tags/9"}]`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "path outside allowlist",
+			patch:          `[{"op":"replace","path":"/version","value":4}]`,
+			allow:          []string{"/name", "/tags"},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "move source outside allowlist",
+			patch:          `[{"op":"move","from":"/address/city","path":"/name"}]`,
+			allow:          []string{"/name"},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "unknown op",
+			patch:          `[{"op":"upsert","path":"/name","value":"x"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing value",
+			patch:          `[{"op":"add","path":"/name"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "result fails validation",
+			patch:          `[{"op":"replace","path":"/address/city","value":""}]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initial := newUser()
+			if tt.initial != nil {
+				tt.initial(&initial)
+			}
+			u := initial
+			err := JSONPatch(&u, []byte(tt.patch), tt.allow...)
+
+			if tt.expectedStatus != 0 {
+				var e errs.ApiError
+				if !errors.As(err, &e) {
+					t.Fatalf("expected ApiError, got %v", err)
+				}
+				if e.StatusCode != tt.expectedStatus {
+					t.Errorf("expected status %d, got %d (%s)", tt.expectedStatus, e.StatusCode, e.Log)
+				}
+				if !reflect.DeepEqual(u, initial) {
+					t.Errorf("target modified on failed patch: %+v", u)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := initial
+			tt.expected(&want)
+			if !reflect.DeepEqual(u, want) {
+				t.Errorf("expected %+v, got %+v", want, u)
+			}
+		})
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json; charset=utf-8",
+			body:        `{"name":"bob"}`,
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/name","value":"bob"}]`,
+		},
+		{
+			name:           "plain json is rejected",
+			contentType:    "application/json",
+			body:           `{"name":"bob"}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/users/42", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			u := newUser()
+			err := ParsePatch(req, &u)
+
+			if tt.expectedStatus != 0 {
+				var e errs.ApiError
+				if !errors.As(err, &e) || e.StatusCode != tt.expectedStatus {
+					t.Fatalf("expected status %d, got %v", tt.expectedStatus, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if u.Name != "bob" || u.ID != 42 {
+				t.Errorf("unexpected result: %+v", u)
+			}
+		})
+	}
+}
+
+func TestOptional(t *testing.T) {
+	type payload struct {
+		Nickname Optional[string] `json:"nickname"`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected Optional[string]
+	}{
+		{name: "absent", body: `{}`, expected: Optional[string]{}},
+		{name: "null", body: `{"nickname":null}`, expected: Null[string]()},
+		{name: "value", body: `{"nickname":"al"}`, expected: Some("al")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p payload
+			if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.Nickname != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, p.Nickname)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package jsonutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"net/http"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type StreamFormat int
+
+const (
+	NDJSON StreamFormat = iota
+	JSONArray
+)
+
+// StreamErrorKey is the key of the sentinel object written as the last
+// element of a stream that failed after the status was already sent:
+//
+//	NDJSON:     {"$error":"internal server error"}\n
+//	JSON array: [{...},{...},{"$error":"internal server error"}]
+//
+// The same message is also sent in the StreamErrorTrailer HTTP trailer.
+const (
+	StreamErrorKey     = "$error"
+	StreamErrorTrailer = "X-Stream-Error"
+)
+
+const (
+	defaultFlushEvery    = 100
+	defaultFlushInterval = time.Second
+)
+
+type StreamOptions struct {
+	Format        StreamFormat
+	FlushEvery    int
+	FlushInterval time.Duration
+}
+
+// StreamError is returned once the response has been committed, Wrap logs it
+// without trying to render a second response.
+type StreamError struct {
+	Err error
+}
+
+func (e StreamError) Error() string {
+	return "stream aborted: " + e.Err.Error()
+}
+
+func (e StreamError) Unwrap() error {
+	return e.Err
+}
+
+func Stream[T any](w http.ResponseWriter, r *http.Request, status int, seq iter.Seq2[T, error], opts StreamOptions) error {
+	sw := newStreamWriter(w, r.Context(), status, opts)
+	for item, err := range seq {
+		if err != nil {
+			return sw.abort(err)
+		}
+		if err := sw.write(item); err != nil {
+			return err
+		}
+	}
+	return sw.close()
+}
+
+func StreamChan[T any](w http.ResponseWriter, r *http.Request, status int, ch <-chan T, opts StreamOptions) error {
+	sw := newStreamWriter(w, r.Context(), status, opts)
+	for {
+		select {
+		case <-sw.ctx.Done():
+			return StreamError{Err: sw.ctx.Err()}
+		case item, ok := <-ch:
+			if !ok {
+				return sw.close()
+			}
+			if err := sw.write(item); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type streamWriter struct {
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	ctx       context.Context
+	opts      StreamOptions
+	count     int
+	pending   int
+	lastFlush time.Time
+}
+
+func newStreamWriter(w http.ResponseWriter, ctx context.Context, status int, opts StreamOptions) *streamWriter {
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = defaultFlushEvery
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+
+	switch opts.Format {
+	case JSONArray:
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Trailer", StreamErrorTrailer)
+	rc := http.NewResponseController(w)
+	// exports may outlast the server wide write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(status)
+
+	sw := &streamWriter{
+		w:         w,
+		rc:        rc,
+		ctx:       ctx,
+		opts:      opts,
+		lastFlush: time.Now(),
+	}
+	if opts.Format == JSONArray {
+		w.Write([]byte("["))
+	}
+	return sw
+}
+
+func (sw *streamWriter) write(item any) error {
+	if err := sw.ctx.Err(); err != nil {
+		return StreamError{Err: err}
+	}
+	if err := sw.writeItem(item); err != nil {
+		return sw.abort(err)
+	}
+	sw.pending++
+	if sw.pending >= sw.opts.FlushEvery || time.Since(sw.lastFlush) >= sw.opts.FlushInterval {
+		sw.flush()
+	}
+	return nil
+}
+
+func (sw *streamWriter) writeItem(item any) error {
+	// marshal before touching the output so a failing item leaves no dangling
+	// separator for the error sentinel to follow
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	// every value ends with a newline, which is exactly the NDJSON record
+	// separator and insignificant whitespace inside an array
+	b = append(b, '\n')
+	if sw.opts.Format == JSONArray && sw.count > 0 {
+		b = append([]byte(","), b...)
+	}
+	sw.count++
+	_, err = sw.w.Write(b)
+	return err
+}
+
+func (sw *streamWriter) flush() {
+	_ = sw.rc.Flush()
+	sw.pending = 0
+	sw.lastFlush = time.Now()
+}
+
+func (sw *streamWriter) close() error {
+	if sw.opts.Format == JSONArray {
+		if _, err := sw.w.Write([]byte("]\n")); err != nil {
+			return StreamError{Err: err}
+		}
+	}
+	sw.flush()
+	return nil
+}
+
+func (sw *streamWriter) abort(err error) error {
+	if ctxErr := sw.ctx.Err(); ctxErr != nil {
+		return StreamError{Err: ctxErr}
+	}
+
+	msg := "internal server error"
+	var e errs.ApiError
+	if errors.As(err, &e) {
+		msg = e.Msg
+	}
+
+	sw.w.Header().Set(StreamErrorTrailer, msg)
+	if werr := sw.writeItem(map[string]string{StreamErrorKey: msg}); werr == nil {
+		sw.close()
+	}
+	return StreamError{Err: err}
+}
@@ -0,0 +1,242 @@
+package jsonutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type row struct {
+	ID int `json:"id"`
+}
+
+func rows(n int, failAt int, failErr error) iter.Seq2[row, error] {
+	return func(yield func(row, error) bool) {
+		for i := 1; i <= n; i++ {
+			if i == failAt {
+				yield(row{}, failErr)
+				return
+			}
+			if !yield(row{ID: i}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        StreamFormat
+		seq           iter.Seq2[row, error]
+		expectedBody  string
+		expectedType  string
+		expectedError bool
+	}{
+		{
+			name:         "ndjson",
+			format:       NDJSON,
+			seq:          rows(3, 0, nil),
+			expectedBody: "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n",
+			expectedType: "application/x-ndjson",
+		},
+		{
+			name:         "json array",
+			format:       JSONArray,
+			seq:          rows(2, 0, nil),
+			expectedBody: "[{\"id\":1}\n,{\"id\":2}\n]\n",
+			expectedType: "application/json",
+		},
+		{
+			name:         "empty json array",
+			format:       JSONArray,
+			seq:          rows(0, 0, nil),
+			expectedBody: "[]\n",
+			expectedType: "application/json",
+		},
+		{
+			name:          "ndjson mid-stream error",
+			format:        NDJSON,
+			seq:           rows(3, 2, errors.New("db gone")),
+			expectedBody:  "{\"id\":1}\n{\"$error\":\"internal server error\"}\n",
+			expectedType:  "application/x-ndjson",
+			expectedError: true,
+		},
+		{
+			name:          "json array mid-stream api error",
+			format:        JSONArray,
+			seq:           rows(3, 3, errs.NewApiError(http.StatusBadGateway, "upstream failed")),
+			expectedBody:  "[{\"id\":1}\n,{\"id\":2}\n,{\"$error\":\"upstream failed\"}\n]\n",
+			expectedType:  "application/json",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/export", nil)
+			w := httptest.NewRecorder()
+
+			err := Stream(w, req, http.StatusOK, tt.seq, StreamOptions{Format: tt.format, FlushEvery: 1})
+
+			var se StreamError
+			if tt.expectedError != errors.As(err, &se) {
+				t.Fatalf("expected stream error %v, got %v", tt.expectedError, err)
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.expectedType {
+				t.Errorf("expected content type %s, got %s", tt.expectedType, ct)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if tt.format == JSONArray && !json.Valid(w.Body.Bytes()) {
+				t.Errorf("expected well-formed json array, got %q", w.Body.String())
+			}
+			if tt.expectedError && w.Result().Trailer.Get(StreamErrorTrailer) == "" {
+				t.Errorf("expected %s trailer to be set", StreamErrorTrailer)
+			}
+		})
+	}
+}
+
+func TestStreamUnencodableItem(t *testing.T) {
+	type reading struct {
+		Value float64 `json:"value"`
+	}
+	nan := math.NaN()
+
+	tests := []struct {
+		name          string
+		items         []reading
+		expectedItems int
+	}{
+		{name: "first item", items: []reading{{Value: nan}, {Value: 2}}, expectedItems: 1},
+		{name: "later item", items: []reading{{Value: 1}, {Value: nan}}, expectedItems: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/export", nil)
+			w := httptest.NewRecorder()
+			seq := func(yield func(reading, error) bool) {
+				for _, item := range tt.items {
+					if !yield(item, nil) {
+						return
+					}
+				}
+			}
+
+			err := Stream(w, req, http.StatusOK, seq, StreamOptions{Format: JSONArray})
+
+			var se StreamError
+			if !errors.As(err, &se) {
+				t.Fatalf("expected stream error, got %v", err)
+			}
+			var decoded []map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("expected well-formed json array, got %q: %v", w.Body.String(), err)
+			}
+			if len(decoded) != tt.expectedItems {
+				t.Fatalf("expected %d elements, got %d: %q", tt.expectedItems, len(decoded), w.Body.String())
+			}
+			if decoded[len(decoded)-1][StreamErrorKey] != "internal server error" {
+				t.Errorf("expected error sentinel as last element, got %v", decoded[len(decoded)-1])
+			}
+		})
+	}
+}
+
+func TestStreamStopsOnDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	produced := 0
+	seq := func(yield func(row, error) bool) {
+		for i := 1; ; i++ {
+			produced++
+			if i == 3 {
+				cancel()
+			}
+			if !yield(row{ID: i}, nil) {
+				return
+			}
+		}
+	}
+
+	err := Stream(w, req, http.StatusOK, seq, StreamOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if produced != 3 {
+		t.Errorf("expected producer to stop after 3 items, got %d", produced)
+	}
+	if strings.Contains(w.Body.String(), StreamErrorKey) {
+		t.Errorf("expected no error sentinel for a disconnected client, got %q", w.Body.String())
+	}
+}
+
+func TestStreamChan(t *testing.T) {
+	ch := make(chan row, 3)
+	ch <- row{ID: 1}
+	ch <- row{ID: 2}
+	close(ch)
+
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	w := httptest.NewRecorder()
+
+	if err := StreamChan(w, req, http.StatusOK, ch, StreamOptions{Format: JSONArray}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []row
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("unexpected rows: %+v", got)
+	}
+}
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seq := func(yield func(row, error) bool) {
+			for i := 1; i <= 4; i++ {
+				time.Sleep(30 * time.Millisecond)
+				if !yield(row{ID: i}, nil) {
+					return
+				}
+			}
+		}
+		Stream(w, r, http.StatusOK, seq, StreamOptions{FlushEvery: 1})
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected the stream to complete, got %v after %q", err, body)
+	}
+	if expected := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n{\"id\":4}\n"; string(body) != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+}
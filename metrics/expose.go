@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// Handler serves the registry in the Prometheus text exposition format, mount
+// it behind middleware.Internal.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.WriteTo(w)
+	})
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.metrics))
+	for _, f := range r.metrics {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	for _, f := range families {
+		f.write(cw)
+	}
+	return cw.n, bw.Flush()
+}
+
+func (f *family) write(w io.Writer) {
+	io.WriteString(w, "# HELP "+f.name+" "+helpEscaper.Replace(f.help)+"\n")
+	io.WriteString(w, "# TYPE "+f.name+" "+string(f.typ)+"\n")
+
+	for _, s := range f.snapshot() {
+		labels := f.labelPairs(s.labelValues)
+		if f.typ != histogramType {
+			writeSample(w, f.name, labels, s.value.load())
+			continue
+		}
+
+		var cumulative uint64
+		for i, le := range f.buckets {
+			cumulative += s.counts[i].Load()
+			writeSample(w, f.name+"_bucket", append(labels, [2]string{"le", formatFloat(le)}), float64(cumulative))
+		}
+		count := float64(s.count.Load())
+		writeSample(w, f.name+"_bucket", append(labels, [2]string{"le", "+Inf"}), count)
+		writeSample(w, f.name+"_sum", labels, s.value.load())
+		writeSample(w, f.name+"_count", labels, count)
+	}
+}
+
+func (f *family) labelPairs(values []string) [][2]string {
+	pairs := make([][2]string, len(values), len(values)+1)
+	for i, v := range values {
+		pairs[i] = [2]string{f.labels[i], v}
+	}
+	return pairs
+}
+
+func writeSample(w io.Writer, name string, labels [][2]string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l[0] + `="` + labelEscaper.Replace(l[1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
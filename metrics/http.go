@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute labels requests no route matched, raw paths are never used
+// as label values so the series count stays bounded.
+const unmatchedRoute = "unmatched"
+
+type httpMetrics struct {
+	requests     *CounterVec
+	duration     *HistogramVec
+	inFlight     *GaugeVec
+	responseSize *HistogramVec
+}
+
+// HTTP records RED metrics per chi route pattern, method and status class,
+// on Default when reg is nil.
+func HTTP(reg *Registry) func(next http.Handler) http.Handler {
+	if reg == nil {
+		reg = Default
+	}
+	m := httpMetrics{
+		requests:     reg.Counter("http_requests_total", "Total HTTP requests.", "method", "route", "status"),
+		duration:     reg.Histogram("http_request_duration_seconds", "HTTP request latency.", DefBuckets, "method", "route", "status"),
+		inFlight:     reg.Gauge("http_requests_in_flight", "HTTP requests currently being served.", "method", "route"),
+		responseSize: reg.Histogram("http_response_size_bytes", "HTTP response body size.", SizeBuckets, "method", "route"),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			method := normalizeMethod(r.Method)
+			inFlight := m.inFlight.With(method, findRoute(r))
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			route := routePattern(r)
+			status := statusClass(ww.Status())
+			m.requests.With(method, route, status).Inc()
+			m.duration.With(method, route, status).Observe(time.Since(start).Seconds())
+			m.responseSize.With(method, route).Observe(float64(ww.BytesWritten()))
+		})
+	}
+}
+
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return unmatchedRoute
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+// findRoute looks up the pattern before the router has matched it, so the
+// in-flight gauge carries the same route label as the other series.
+func findRoute(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return unmatchedRoute
+	}
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	pattern := rctx.Routes.Find(chi.NewRouteContext(), r.Method, path)
+	if pattern == "" && r.Method == http.MethodHead {
+		// chi serves HEAD with the GET handler
+		pattern = rctx.Routes.Find(chi.NewRouteContext(), http.MethodGet, path)
+	}
+	if pattern == "" {
+		return unmatchedRoute
+	}
+	return pattern
+}
+
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+func statusClass(status int) string {
+	if status == 0 {
+		// nothing was written, net/http sends 200
+		status = http.StatusOK
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
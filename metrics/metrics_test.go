@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	jobs := reg.Counter("jobs_total", "Jobs processed.", "queue")
+	jobs.With("emails").Inc()
+	jobs.With("emails").Add(2)
+	jobs.With(`we"ird`).Inc()
+
+	reg.Gauge("workers", "Active workers.").With().Set(3)
+
+	lat := reg.Histogram("job_seconds", "Job latency.", []float64{0.1, 1})
+	lat.With().Observe(0.05)
+	lat.With().Observe(0.5)
+	lat.With().Observe(5)
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := `# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.1"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 5.55
+job_seconds_count 3
+# HELP jobs_total Jobs processed.
+# TYPE jobs_total counter
+jobs_total{queue="emails"} 3
+jobs_total{queue="we\"ird"} 1
+# HELP workers Active workers.
+# TYPE workers gauge
+workers 3
+`
+	if w.Body.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", w.Body.String(), expected)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	reg := NewRegistry()
+	a := reg.Counter("requests_total", "Requests.", "method")
+	b := reg.Counter("requests_total", "Requests.", "method")
+	a.With("GET").Inc()
+	b.With("GET").Inc()
+
+	var out strings.Builder
+	reg.WriteTo(&out)
+	if !strings.Contains(out.String(), `requests_total{method="GET"} 2`) {
+		t.Errorf("expected shared series, got:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for conflicting registration")
+		}
+	}()
+	reg.Gauge("requests_total", "Requests.", "method")
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	reg := NewRegistry()
+	r := chi.NewRouter()
+	r.Use(HTTP(reg))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user"))
+	})
+	r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	var during strings.Builder
+	r.Route("/admin", func(r chi.Router) {
+		r.Get("/stats/{name}", func(w http.ResponseWriter, r *http.Request) {
+			reg.WriteTo(&during)
+		})
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/users/2", nil),
+		httptest.NewRequest(http.MethodPost, "/users", nil),
+		httptest.NewRequest(http.MethodGet, "/admin/stats/cpu", nil),
+		httptest.NewRequest(http.MethodGet, "/random/path/123", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var out strings.Builder
+	reg.WriteTo(&out)
+	body := out.String()
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/{id}",status="2xx"} 2`,
+		`http_requests_total{method="POST",route="/users",status="4xx"} 1`,
+		`http_requests_total{method="GET",route="/admin/stats/{name}",status="2xx"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`http_requests_in_flight{method="GET",route="/users/{id}"} 0`,
+		`http_requests_in_flight{method="GET",route="unmatched"} 0`,
+		`http_response_size_bytes_sum{method="GET",route="/users/{id}"} 8`,
+		`http_request_duration_seconds_count{method="GET",route="/users/{id}",status="2xx"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "/users/1") || strings.Contains(body, "/random") {
+		t.Errorf("raw paths leaked into labels:\n%s", body)
+	}
+	if want := `http_requests_in_flight{method="GET",route="/admin/stats/{name}"} 1`; !strings.Contains(during.String(), want) {
+		t.Errorf("missing %s while serving in:\n%s", want, during.String())
+	}
+}
+
+func TestHTTPDefaultRegistry(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTP(nil))
+	r.Get("/default/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/default/1", nil))
+
+	var out strings.Builder
+	Default.WriteTo(&out)
+	if want := `http_requests_total{method="GET",route="/default/{id}",status="2xx"} 1`; !strings.Contains(out.String(), want) {
+		t.Errorf("expected nil registry to fall back to Default, missing %s", want)
+	}
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+// Encoder is a pooled compressor, *gzip.Writer and *zlib.Writer qualify and
+// so do the common brotli and zstd writers.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type CompressOptions struct {
+	Level int
+	// MinSize below which responses are sent as is, 1 KiB by default.
+	MinSize int
+	// Types that get compressed, "text/*" style wildcards allowed.
+	Types []string
+	// Encoders adds encodings (e.g. "br") preferred over gzip and deflate
+	// when the client accepts them with the same q-value.
+	Encoders map[string]func(level int) Encoder
+}
+
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+type encoding struct {
+	name string
+	pool *sync.Pool
+}
+
+// Compress negotiates a content encoding from Accept-Encoding and compresses
+// compressible responses once they reach MinSize. Responses that already
+// carry a Content-Encoding, SSE streams, HEAD requests, 204/304 and ranges
+// pass through untouched. Register it inside Logger so the log line shows
+// both the wire size and the uncompressed size.
+func Compress(opts CompressOptions) func(next http.Handler) http.Handler {
+	if opts.Level == 0 {
+		opts.Level = 5
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = defaultCompressTypes
+	}
+
+	var encodings []encoding
+	add := func(name string, fn func(level int) Encoder) {
+		encodings = append(encodings, encoding{
+			name: name,
+			pool: &sync.Pool{New: func() any { return fn(opts.Level) }},
+		})
+	}
+	names := make([]string, 0, len(opts.Encoders))
+	for name := range opts.Encoders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		add(name, opts.Encoders[name])
+	}
+	add("gzip", func(level int) Encoder {
+		w, err := gzip.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			w = gzip.NewWriter(io.Discard)
+		}
+		return w
+	})
+	// HTTP "deflate" is the zlib format (RFC 9110), not a raw deflate stream
+	add("deflate", func(level int) Encoder {
+		w, err := zlib.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			w = zlib.NewWriter(io.Discard)
+		}
+		return w
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			enc, ok := negotiate(r.Header.Get("Accept-Encoding"), encodings)
+			if !ok || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, enc: enc}
+			defer func() {
+				if p := recover(); p != nil {
+					// leave the response uncommitted so Recoverer can write its 500
+					cw.discard()
+					panic(p)
+				}
+				cw.close()
+			}()
+			if stats, ok := r.Context().Value(responseStatsKey{}).(*responseStats); ok {
+				cw.stats = stats
+			}
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiate picks the accepted encoding with the highest q-value, ties go to
+// the server's order.
+func negotiate(header string, encodings []encoding) (encoding, bool) {
+	if header == "" {
+		return encoding{}, false
+	}
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+
+	var best encoding
+	bestQ := 0.0
+	for _, enc := range encodings {
+		weight, ok := q[enc.name]
+		if !ok {
+			if enc.name == "gzip" {
+				weight, ok = q["x-gzip"]
+			}
+			if !ok {
+				weight = q["*"]
+			}
+		}
+		if weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best, bestQ > 0
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	opts  *CompressOptions
+	enc   encoding
+	stats *responseStats
+
+	status      int
+	buf         []byte
+	decided     bool
+	encoder     Encoder
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+	if code < 200 && code != http.StatusSwitchingProtocols {
+		// informational responses (103 Early Hints) go out as they are
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent || code == http.StatusSwitchingProtocols {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.stats != nil {
+		cw.stats.raw += int64(len(b))
+	}
+	if !cw.decided {
+		if !cw.compressible() {
+			cw.decide(false)
+		} else {
+			cw.buf = append(cw.buf, b...)
+			if len(cw.buf) < cw.opts.MinSize {
+				return len(b), nil
+			}
+			cw.decide(true)
+			return len(b), nil
+		}
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// compressible looks at the headers the handler has set so far.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.opts.MinSize {
+			return false
+		}
+	}
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || mt == "text/event-stream" {
+		return false
+	}
+	for _, t := range cw.opts.Types {
+		if t == mt {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(mt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide sends the header and whatever was buffered, compressed or not.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.enc.name)
+		if etag := h.Get("ETag"); etag != "" {
+			// the compressed bytes differ, tag them apart but keep them strong
+			h.Set("ETag", jsonutil.EncodedETag(etag, cw.enc.name))
+		}
+		cw.encoder = cw.enc.pool.Get().(Encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+		if cw.stats != nil {
+			cw.stats.encoding = cw.enc.name
+		}
+	}
+	cw.writeHeader()
+	if len(cw.buf) > 0 {
+		if cw.encoder != nil {
+			cw.encoder.Write(cw.buf)
+		} else {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+		cw.buf = nil
+	}
+}
+
+func (cw *compressWriter) writeHeader() {
+	if cw.wroteHeader || cw.status == 0 {
+		return
+	}
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// Flush commits to compression for compressible streams even below MinSize,
+// more data is on its way.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(cw.compressible())
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		// the whole body stayed under MinSize
+		cw.decide(false)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		cw.encoder.Reset(io.Discard)
+		cw.enc.pool.Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// discard drops the buffered body and the encoder without writing anything.
+func (cw *compressWriter) discard() {
+	cw.buf = nil
+	if cw.encoder != nil {
+		cw.encoder.Reset(io.Discard)
+		cw.enc.pool.Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+type responseStatsKey struct{}
+
+// responseStats lets Compress tell Logger how big the response was before
+// compression.
+type responseStats struct {
+	raw      int64
+	encoding string
+}
+
+func withResponseStats(r *http.Request) (*http.Request, *responseStats) {
+	stats := &responseStats{}
+	return r.WithContext(context.WithValue(r.Context(), responseStatsKey{}, stats)), stats
+}
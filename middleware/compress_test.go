@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var bigJSON = `{"data":"` + strings.Repeat("a", 4096) + `"}`
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		method           string
+		contentType      string
+		contentEncoding  string
+		body             string
+		status           int
+		expectedEncoding string
+	}{
+		{name: "gzip", acceptEncoding: "gzip, deflate", contentType: "application/json", body: bigJSON, expectedEncoding: "gzip"},
+		{name: "deflate preferred by q", acceptEncoding: "gzip;q=0.5, deflate", contentType: "application/json", body: bigJSON, expectedEncoding: "deflate"},
+		{name: "wildcard", acceptEncoding: "*", contentType: "text/html; charset=utf-8", body: bigJSON, expectedEncoding: "gzip"},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0, deflate;q=0", contentType: "application/json", body: bigJSON},
+		{name: "no accept-encoding", contentType: "application/json", body: bigJSON},
+		{name: "below min size", acceptEncoding: "gzip", contentType: "application/json", body: `{"ok":true}`},
+		{name: "not compressible", acceptEncoding: "gzip", contentType: "image/png", body: bigJSON},
+		{name: "already encoded", acceptEncoding: "gzip", contentType: "application/json", contentEncoding: "br", body: bigJSON, expectedEncoding: "br"},
+		{name: "event stream", acceptEncoding: "gzip", contentType: "text/event-stream", body: bigJSON},
+		{name: "head request", acceptEncoding: "gzip", method: http.MethodHead, contentType: "application/json", body: bigJSON},
+		{name: "no content", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// several writes to cross MinSize midway
+				for chunk := range chunks(tt.body, 1000) {
+					w.Write([]byte(chunk))
+				}
+			}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if enc := w.Header().Get("Content-Encoding"); enc != tt.expectedEncoding {
+				t.Fatalf("expected encoding '%s', got '%s'", tt.expectedEncoding, enc)
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("expected Vary: Accept-Encoding, got %v", w.Header()["Vary"])
+			}
+
+			var body io.Reader = w.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, _ := io.ReadAll(body)
+			if string(got) != tt.body {
+				t.Errorf("expected body of %d bytes, got %d", len(tt.body), len(got))
+			}
+		})
+	}
+}
+
+func chunks(s string, n int) func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(s) > 0 {
+			end := min(n, len(s))
+			if !yield(s[:end]) {
+				return
+			}
+			s = s[end:]
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	h := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"n":1}` + "\n"))
+		http.NewResponseController(w).Flush()
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected flushed gzip stream, got flushed=%v encoding=%s", w.Flushed, w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != `{"n":1}`+"\n" {
+		t.Errorf("unexpected body %q", got)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	h := Recoverer(Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"partial":`))
+		panic("boom")
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 from Recoverer, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "partial") || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected the buffered body to be dropped, got %q encoding=%s", w.Body, w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressLoggerSizes(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	h := Logger(Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(bigJSON))
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	expected := "B (gzip, 4107B raw)"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected log line with %q, got %s", expected, out.String())
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// defaultMaxDecompressed bounds decompressed bodies when Decompress gets no
+// limit, an unbounded one would let a zip bomb through.
+const defaultMaxDecompressed = 10 << 20
+
+// maxEncodings caps how many codings a body may stack, each layer allocates
+// a decompressor before a single byte of output is produced.
+const maxEncodings = 2
+
+// Decompress decodes gzip and deflate request bodies so handlers and
+// jsonutil.Parse read plain JSON. Reading past maxSize decompressed bytes
+// (10 MiB when maxSize <= 0) fails with *http.MaxBytesError, which Wrap
+// renders as 413. Other encodings, and bodies stacking more than two codings,
+// are rejected with 415.
+func Decompress(maxSize int64) func(next http.Handler) http.Handler {
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecompressed
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Content-Encoding")
+			if header == "" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// encodings are listed in the order they were applied
+			encodings := strings.Split(header, ",")
+			layers := 0
+			for _, enc := range encodings {
+				if enc := strings.TrimSpace(enc); enc != "" && !strings.EqualFold(enc, "identity") {
+					layers++
+				}
+			}
+			if layers > maxEncodings {
+				w.Header().Set("Accept-Encoding", "gzip, deflate")
+				RenderError(w, r, errs.TooManyEncodings(layers, maxEncodings))
+				return
+			}
+
+			closers := []io.Closer{r.Body}
+			var body io.Reader = r.Body
+			for i := len(encodings) - 1; i >= 0; i-- {
+				enc := strings.ToLower(strings.TrimSpace(encodings[i]))
+				var err error
+				switch enc {
+				case "identity", "":
+					continue
+				case "gzip", "x-gzip":
+					var zr *gzip.Reader
+					zr, err = gzip.NewReader(body)
+					body, closers = zr, append(closers, zr)
+				case "deflate":
+					var rc io.ReadCloser
+					rc, err = deflateReader(body)
+					body, closers = rc, append(closers, rc)
+				default:
+					w.Header().Set("Accept-Encoding", "gzip, deflate")
+					RenderError(w, r, errs.UnsupportedEncoding(enc))
+					return
+				}
+				if err != nil {
+					RenderError(w, r, errs.InvalidCompressedBody(err))
+					return
+				}
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = &decompressedBody{r: body, closers: closers, remaining: maxSize, limit: maxSize}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deflateReader accepts the zlib format HTTP specifies as well as the raw
+// deflate streams some clients send instead.
+func deflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+type decompressedBody struct {
+	r         io.Reader
+	closers   []io.Closer
+	remaining int64
+	limit     int64
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// probe for more data past the limit before failing
+		var one [1]byte
+		n, err := b.r.Read(one[:])
+		if n > 0 {
+			return 0, &http.MaxBytesError{Limit: b.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	var errList []error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		errList = append(errList, b.closers[i].Close())
+	}
+	return errors.Join(errList...)
+}
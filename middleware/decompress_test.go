@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zlibbed(s string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func rawDeflated(s string) []byte {
+	var buf bytes.Buffer
+	zw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	payload := `{"name":"` + strings.Repeat("x", 100) + `"}`
+
+	tests := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		maxSize        int64
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "plain body", body: []byte(payload), maxSize: 1024, expectedStatus: http.StatusOK},
+		{name: "gzip", encoding: "gzip", body: gzipped(payload), maxSize: 1024, expectedStatus: http.StatusOK},
+		{name: "deflate zlib", encoding: "deflate", body: zlibbed(payload), maxSize: 1024, expectedStatus: http.StatusOK},
+		{name: "deflate raw", encoding: "deflate", body: rawDeflated(payload), maxSize: 1024, expectedStatus: http.StatusOK},
+		{name: "stacked", encoding: "deflate, gzip", body: gzipped(string(zlibbed(payload))), maxSize: 1024, expectedStatus: http.StatusOK},
+		{name: "exact limit", encoding: "gzip", body: gzipped(payload), maxSize: int64(len(payload)), expectedStatus: http.StatusOK},
+		{name: "zip bomb", encoding: "gzip", body: gzipped(`{"name":"` + strings.Repeat("x", 1<<20) + `"}`), maxSize: 1024, expectedStatus: http.StatusRequestEntityTooLarge, expectedError: "request body too large"},
+		{name: "default limit", encoding: "gzip", body: gzipped(payload), expectedStatus: http.StatusOK},
+		{name: "default limit bomb", encoding: "gzip", body: gzipped(`{"name":"` + strings.Repeat("x", 11<<20) + `"}`), expectedStatus: http.StatusRequestEntityTooLarge, expectedError: "request body too large"},
+		{name: "too many encodings", encoding: strings.Repeat("gzip, ", 2000) + "gzip", body: gzipped(payload), maxSize: 1024, expectedStatus: http.StatusUnsupportedMediaType, expectedError: "too many content encodings"},
+		{name: "three encodings", encoding: "gzip, identity, deflate, gzip", body: gzipped(payload), maxSize: 1024, expectedStatus: http.StatusUnsupportedMediaType, expectedError: "too many content encodings"},
+		{name: "unsupported", encoding: "br", body: []byte("whatever"), maxSize: 1024, expectedStatus: http.StatusUnsupportedMediaType, expectedError: "unsupported content encoding"},
+		{name: "corrupt gzip", encoding: "gzip", body: []byte("not gzip"), maxSize: 1024, expectedStatus: http.StatusBadRequest, expectedError: "invalid compressed body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Decompress(tt.maxSize)(Wrap(func(w http.ResponseWriter, r *http.Request) error {
+				if r.Header.Get("Content-Encoding") != "" {
+					t.Error("expected Content-Encoding to be removed")
+				}
+				var payload struct {
+					Name string `json:"name"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					return err
+				}
+				return jsonutil.Write(w, http.StatusOK, payload)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			var response map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if tt.expectedError != "" && response["error"] != tt.expectedError {
+				t.Errorf("expected error message '%s', got '%s'", tt.expectedError, response["error"])
+			}
+			if tt.expectedError == "" && response["name"] != strings.Repeat("x", 100) {
+				t.Errorf("unexpected payload %v", response)
+			}
+		})
+	}
+}
+
+func TestDecompressLimitReader(t *testing.T) {
+	h := Decompress(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if len(b) != 10 {
+			t.Errorf("expected 10 bytes before the limit, got %d", len(b))
+		}
+		if _, ok := err.(*http.MaxBytesError); !ok {
+			t.Errorf("expected MaxBytesError, got %v", err)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(gzipped(strings.Repeat("a", 100))))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+type ETagOptions struct {
+	// Weak marks computed ETags as weak.
+	Weak bool
+	// MaxBuffer caps the body held back for hashing, larger responses go out
+	// without an ETag. 1 MiB by default.
+	MaxBuffer int
+}
+
+// ETag adds an ETag to 200 responses of GET and HEAD requests, hashed from the
+// body unless the handler set one (see jsonutil.VersionETag), and answers a
+// matching If-None-Match with 304. Register it inside Compress so the raw body
+// is hashed and 304s skip compression.
+func ETag(opts ETagOptions) func(next http.Handler) http.Handler {
+	if opts.MaxBuffer <= 0 {
+		opts.MaxBuffer = 1 << 20
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, opts: &opts, ifNoneMatch: r.Header.Get("If-None-Match")}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
+}
+
+type etagWriter struct {
+	http.ResponseWriter
+	opts        *ETagOptions
+	ifNoneMatch string
+
+	status      int
+	buf         []byte
+	passthrough bool
+	notModified bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.status != 0 {
+		return
+	}
+	if code < 200 {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	ew.status = code
+	if code != http.StatusOK {
+		ew.pass()
+		return
+	}
+	if etag := ew.Header().Get("ETag"); etag != "" {
+		// the handler knows its version, no need to hold the body back
+		if jsonutil.MatchETag(ew.ifNoneMatch, etag) {
+			ew.writeNotModified()
+		} else {
+			ew.pass()
+		}
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case ew.notModified:
+		return len(b), nil
+	case ew.passthrough:
+		return ew.ResponseWriter.Write(b)
+	case len(ew.buf)+len(b) > ew.opts.MaxBuffer:
+		ew.pass()
+		return ew.ResponseWriter.Write(b)
+	}
+	ew.buf = append(ew.buf, b...)
+	return len(b), nil
+}
+
+// pass sends the header and anything buffered, the rest streams through.
+func (ew *etagWriter) pass() {
+	ew.passthrough = true
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if len(ew.buf) > 0 {
+		ew.ResponseWriter.Write(ew.buf)
+		ew.buf = nil
+	}
+}
+
+func (ew *etagWriter) writeNotModified() {
+	ew.notModified = true
+	h := ew.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+// finish hashes the buffered body once the handler is done.
+func (ew *etagWriter) finish() {
+	if ew.status == 0 || ew.passthrough || ew.notModified {
+		return
+	}
+	if len(ew.buf) > 0 {
+		etag := jsonutil.StrongETag(ew.buf)
+		if ew.opts.Weak {
+			etag = jsonutil.WeakETag(ew.buf)
+		}
+		ew.Header().Set("ETag", etag)
+		if jsonutil.MatchETag(ew.ifNoneMatch, etag) {
+			ew.writeNotModified()
+			return
+		}
+	}
+	ew.pass()
+}
+
+// Flush gives up on hashing, a flushed stream has no single body.
+func (ew *etagWriter) Flush() {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if !ew.passthrough && !ew.notModified {
+		ew.pass()
+	}
+	http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+func TestETag(t *testing.T) {
+	body := map[string]int{"id": 1}
+	computed := jsonutil.StrongETag([]byte("{\"id\":1}\n"))
+
+	tests := []struct {
+		name           string
+		method         string
+		version        string
+		status         int
+		ifNoneMatch    string
+		opts           ETagOptions
+		expectedStatus int
+		expectedETag   string
+	}{
+		{name: "computed", expectedStatus: http.StatusOK, expectedETag: computed},
+		{name: "computed weak", opts: ETagOptions{Weak: true}, expectedStatus: http.StatusOK, expectedETag: "W/" + computed},
+		{name: "not modified", ifNoneMatch: computed, expectedStatus: http.StatusNotModified, expectedETag: computed},
+		{name: "weak comparison", ifNoneMatch: "W/" + computed, expectedStatus: http.StatusNotModified, expectedETag: computed},
+		{name: "stale", ifNoneMatch: `"old"`, expectedStatus: http.StatusOK, expectedETag: computed},
+		{name: "handler version", version: `"7"`, ifNoneMatch: `"7"`, expectedStatus: http.StatusNotModified, expectedETag: `"7"`},
+		{name: "handler version changed", version: `"8"`, ifNoneMatch: `"7"`, expectedStatus: http.StatusOK, expectedETag: `"8"`},
+		{name: "not ok", status: http.StatusNotFound, expectedStatus: http.StatusNotFound},
+		{name: "unsafe method", method: http.MethodPut, expectedStatus: http.StatusOK},
+		{name: "too big to hash", opts: ETagOptions{MaxBuffer: 4}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := ETag(tt.opts)(Wrap(func(w http.ResponseWriter, r *http.Request) error {
+				if tt.version != "" {
+					w.Header().Set("ETag", tt.version)
+				}
+				status := tt.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				return jsonutil.Write(w, status, body)
+			}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/items/1", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if etag := w.Header().Get("ETag"); etag != tt.expectedETag {
+				t.Errorf("expected ETag '%s', got '%s'", tt.expectedETag, etag)
+			}
+			if w.Code == http.StatusNotModified {
+				if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+					t.Errorf("expected empty 304, got %q with %v", w.Body, w.Header())
+				}
+			} else if !strings.Contains(w.Body.String(), `"id":1`) {
+				t.Errorf("unexpected body %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestETagFlush(t *testing.T) {
+	h := ETag(ETagOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"n":1}` + "\n"))
+		http.NewResponseController(w).Flush()
+		w.Write([]byte(`{"n":2}` + "\n"))
+	}))
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !w.Flushed || w.Header().Get("ETag") != "" {
+		t.Errorf("expected flushed stream without ETag, got flushed=%v etag=%s", w.Flushed, w.Header().Get("ETag"))
+	}
+	if w.Body.String() != `{"n":1}`+"\n"+`{"n":2}`+"\n" {
+		t.Errorf("unexpected body %q", w.Body)
+	}
+}
+
+func TestETagThroughCompress(t *testing.T) {
+	body := map[string]string{"text": strings.Repeat("a", 2048)}
+	current := `"7"`
+	h := Compress(CompressOptions{})(ETag(ETagOptions{})(Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method == http.MethodPut {
+			if err := jsonutil.RequireIfMatch(r, current); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		w.Header().Set("ETag", current)
+		return jsonutil.Write(w, http.StatusOK, body)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	if etag != `"7+gzip"` {
+		t.Fatalf("expected strong encoded ETag, got %q", etag)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "revalidate compressed", method: http.MethodGet, header: "If-None-Match", value: etag, expectedStatus: http.StatusNotModified},
+		{name: "update with compressed tag", method: http.MethodPut, header: "If-Match", value: etag, expectedStatus: http.StatusNoContent},
+		{name: "update with weak tag", method: http.MethodPut, header: "If-Match", value: "W/" + etag, expectedStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/items/1", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
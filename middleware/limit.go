@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type LimiterOptions struct {
+	// Limit of concurrently served requests, the starting point in adaptive mode.
+	Limit int
+	// MaxWait a request may queue for a free slot, zero sheds immediately.
+	MaxWait time.Duration
+	// MaxQueue bounds the waiting requests, defaults to Limit.
+	MaxQueue   int
+	RetryAfter time.Duration
+	// Adaptive, when set, moves the limit between MinLimit and MaxLimit from
+	// observed latency.
+	Adaptive *AdaptiveOptions
+}
+
+// AdaptiveOptions configure AIMD: the limit grows by one per window of fast
+// responses while it is being used, and is multiplied by Backoff when a
+// response is slower than Target or comes back 503/504.
+type AdaptiveOptions struct {
+	MinLimit int
+	MaxLimit int
+	Target   time.Duration
+	Backoff  float64
+}
+
+// Limiter caps in-flight requests for everything behind its Handler, use one
+// globally and separate ones per route group.
+type Limiter struct {
+	opts LimiterOptions
+
+	mu           sync.Mutex
+	limit        int
+	inFlight     int
+	waiters      list.List
+	successes    int
+	lastDecrease time.Time
+}
+
+// NewLimiter fills in zero options. In adaptive mode inconsistent bounds are
+// clamped: MaxLimit is raised to MinLimit and the starting Limit is moved
+// inside [MinLimit, MaxLimit].
+func NewLimiter(opts LimiterOptions) *Limiter {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	if opts.Adaptive != nil {
+		a := *opts.Adaptive
+		opts.Adaptive = &a
+		if a.MinLimit <= 0 {
+			a.MinLimit = 1
+		}
+		if a.MaxLimit <= 0 {
+			a.MaxLimit = max(opts.Limit*10, a.MinLimit)
+		}
+		if a.MaxLimit < a.MinLimit {
+			a.MaxLimit = a.MinLimit
+		}
+		opts.Limit = min(max(opts.Limit, a.MinLimit), a.MaxLimit)
+		if a.Backoff <= 0 || a.Backoff >= 1 {
+			a.Backoff = 0.9
+		}
+		if a.Target <= 0 {
+			a.Target = 250 * time.Millisecond
+		}
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = opts.Limit
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	return &Limiter{opts: opts, limit: opts.Limit}
+}
+
+// ConcurrencyLimit is a fixed limiter with a bounded queue wait.
+func ConcurrencyLimit(limit int, maxWait time.Duration) func(next http.Handler) http.Handler {
+	return NewLimiter(LimiterOptions{Limit: limit, MaxWait: maxWait}).Handler
+}
+
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire(r) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.opts.RetryAfter.Seconds()))))
+			RenderError(w, r, errs.ServiceUnavailable("concurrency limit reached: "+r.Method+" "+r.URL.Path))
+			return
+		}
+
+		if l.opts.Adaptive == nil {
+			defer l.release(0, 0)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() { l.release(time.Since(start), ww.Status()) }()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+func (l *Limiter) acquire(r *http.Request) bool {
+	l.mu.Lock()
+	if l.inFlight < l.limit && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if l.opts.MaxWait <= 0 || l.waiters.Len() >= l.opts.MaxQueue {
+		l.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.opts.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// granted while we were giving up, hand the slot on
+		l.inFlight--
+		l.grant()
+	default:
+		l.waiters.Remove(elem)
+	}
+	return false
+}
+
+// release frees a slot, latency and status feed the adaptive limit.
+func (l *Limiter) release(latency time.Duration, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if a := l.opts.Adaptive; a != nil {
+		l.adapt(a, latency, status)
+	}
+	l.inFlight--
+	l.grant()
+}
+
+func (l *Limiter) adapt(a *AdaptiveOptions, latency time.Duration, status int) {
+	now := time.Now()
+	if latency > a.Target || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout {
+		// one decrease per round trip, a burst of slow responses is one signal
+		if now.Sub(l.lastDecrease) >= latency {
+			l.limit = max(a.MinLimit, int(float64(l.limit)*a.Backoff))
+			l.lastDecrease = now
+		}
+		l.successes = 0
+		return
+	}
+	// only grow while the current limit is actually the bottleneck
+	if l.inFlight >= l.limit || l.waiters.Len() > 0 {
+		l.successes++
+		if l.successes >= l.limit {
+			l.limit = min(a.MaxLimit, l.limit+1)
+			l.successes = 0
+		}
+	}
+}
+
+// grant hands free slots to queued requests in arrival order, callers hold mu.
+func (l *Limiter) grant() {
+	for l.inFlight < l.limit && l.waiters.Len() > 0 {
+		ready := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.inFlight++
+		close(ready)
+	}
+}
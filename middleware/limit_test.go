@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveConcurrently blocks n handlers inside l until release is closed and
+// returns once they all hold a slot.
+func serveConcurrently(t *testing.T, l *Limiter, n int, release chan struct{}) *sync.WaitGroup {
+	t.Helper()
+	entered := make(chan struct{}, n)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	var wg sync.WaitGroup
+	for range n {
+		wg.Go(func() {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	}
+	for range n {
+		<-entered
+	}
+	return &wg
+}
+
+func TestLimiterSheds(t *testing.T) {
+	l := NewLimiter(LimiterOptions{Limit: 2, RetryAfter: 3 * time.Second})
+	release := make(chan struct{})
+	wg := serveConcurrently(t, l, 2, release)
+
+	w := httptest.NewRecorder()
+	l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not run over the limit")
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "3" {
+		t.Errorf("expected Retry-After 3, got %s", w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+	if l.InFlight() != 0 {
+		t.Errorf("expected all slots released, got %d", l.InFlight())
+	}
+}
+
+func TestLimiterQueue(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxWait        time.Duration
+		releaseAfter   time.Duration
+		expectedStatus int
+	}{
+		{name: "slot frees within wait", maxWait: time.Second, releaseAfter: 20 * time.Millisecond, expectedStatus: http.StatusOK},
+		{name: "wait expires", maxWait: 20 * time.Millisecond, releaseAfter: 200 * time.Millisecond, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(LimiterOptions{Limit: 1, MaxWait: tt.maxWait})
+			release := make(chan struct{})
+			wg := serveConcurrently(t, l, 1, release)
+			time.AfterFunc(tt.releaseAfter, func() { close(release) })
+
+			w := httptest.NewRecorder()
+			l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+				ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			wg.Wait()
+			if l.InFlight() != 0 {
+				t.Errorf("expected all slots released, got %d", l.InFlight())
+			}
+		})
+	}
+}
+
+func TestLimiterQueueBound(t *testing.T) {
+	l := NewLimiter(LimiterOptions{Limit: 1, MaxWait: time.Second, MaxQueue: 1})
+	release := make(chan struct{})
+	wg := serveConcurrently(t, l, 1, release)
+
+	// one request waits in the queue, the next one is shed right away
+	queued := make(chan int, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		queued <- w.Code
+	}()
+	for {
+		l.mu.Lock()
+		n := l.waiters.Len()
+		l.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected immediate 503, got %d after %s", w.Code, time.Since(start))
+	}
+
+	close(release)
+	wg.Wait()
+	if code := <-queued; code != http.StatusOK {
+		t.Errorf("expected queued request to be served, got %d", code)
+	}
+}
+
+func TestLimiterAdaptive(t *testing.T) {
+	l := NewLimiter(LimiterOptions{
+		Limit:    10,
+		Adaptive: &AdaptiveOptions{MinLimit: 2, MaxLimit: 20, Target: 5 * time.Millisecond, Backoff: 0.5},
+	})
+
+	l.mu.Lock()
+	l.inFlight = 1
+	l.adapt(l.opts.Adaptive, 50*time.Millisecond, http.StatusOK)
+	l.mu.Unlock()
+	if l.Limit() != 5 {
+		t.Errorf("expected multiplicative decrease to 5, got %d", l.Limit())
+	}
+
+	// saturated and fast: one increase per window of limit successes
+	l.mu.Lock()
+	l.inFlight = l.limit
+	for range 5 {
+		l.adapt(l.opts.Adaptive, time.Millisecond, http.StatusOK)
+	}
+	l.mu.Unlock()
+	if l.Limit() != 6 {
+		t.Errorf("expected additive increase to 6, got %d", l.Limit())
+	}
+
+	// not saturated: no reason to grow
+	l.mu.Lock()
+	l.inFlight = 1
+	for range 50 {
+		l.adapt(l.opts.Adaptive, time.Millisecond, http.StatusOK)
+	}
+	l.lastDecrease = time.Time{}
+	l.adapt(l.opts.Adaptive, time.Millisecond, http.StatusServiceUnavailable)
+	l.mu.Unlock()
+	if l.Limit() != 3 {
+		t.Errorf("expected decrease on 503 to 3, got %d", l.Limit())
+	}
+}
+
+func TestLimiterAdaptiveBounds(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		adaptive      AdaptiveOptions
+		expectedLimit int
+		expectedMin   int
+		expectedMax   int
+	}{
+		{name: "defaults", limit: 10, expectedLimit: 10, expectedMin: 1, expectedMax: 100},
+		{name: "explicit max below limit", limit: 50, adaptive: AdaptiveOptions{MaxLimit: 20}, expectedLimit: 20, expectedMin: 1, expectedMax: 20},
+		{name: "min above limit", limit: 10, adaptive: AdaptiveOptions{MinLimit: 30}, expectedLimit: 30, expectedMin: 30, expectedMax: 100},
+		{name: "min above max", limit: 10, adaptive: AdaptiveOptions{MinLimit: 30, MaxLimit: 20}, expectedLimit: 30, expectedMin: 30, expectedMax: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(LimiterOptions{Limit: tt.limit, Adaptive: &tt.adaptive})
+			a := l.opts.Adaptive
+			if l.Limit() != tt.expectedLimit || a.MinLimit != tt.expectedMin || a.MaxLimit != tt.expectedMax {
+				t.Errorf("expected limit %d in [%d, %d], got %d in [%d, %d]",
+					tt.expectedLimit, tt.expectedMin, tt.expectedMax, l.Limit(), a.MinLimit, a.MaxLimit)
+			}
+		})
+	}
+}
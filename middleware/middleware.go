@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -66,14 +68,25 @@ func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		before := time.Now()
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r, stats := withResponseStats(r)
 
 		defer func() {
 			duration := time.Since(before)
-			log.Printf("[%s] %s %s %.2fms",
+			size := fmt.Sprintf("%dB", ww.BytesWritten())
+			if stats.encoding != "" {
+				size += fmt.Sprintf(" (%s, %dB raw)", stats.encoding, stats.raw)
+			}
+			trace := ""
+			if id := cctx.TraceID(r.Context()); id != "" {
+				trace = " trace_id=" + id
+			}
+			log.Printf("[%s] %s %s %.2fms %s%s",
 				colorMethod(r.Method),
 				r.RequestURI,
 				colorStatus(ww.Status()),
-				float64(duration.Microseconds())/1000.0)
+				float64(duration.Microseconds())/1000.0,
+				size,
+				trace)
 		}()
 
 		next.ServeHTTP(ww, r)
@@ -92,20 +105,47 @@ func Recoverer(next http.Handler) http.Handler {
 func Wrap(final HandlerWithErr) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := final(w, r); err != nil {
-			var e errs.ApiError
-			if errors.As(err, &e) {
-				jsonutil.Write(w, e.StatusCode, e.Map())
-				log.Printf("%sAPI ERROR%s: %s", colorRed, colorReset, e.Log)
-			} else {
-				jsonutil.Write(w, http.StatusInternalServerError, map[string]string{
-					"error": "internal server error",
-				})
-				log.Printf("%sUNKNOWN ERROR%s: %s", colorRed, colorReset, err.Error())
-			}
+			RenderError(w, r, err)
 		}
 	}
 }
 
+// RenderError writes err the way Wrap does, for middlewares that reject a
+// request before the handler runs.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	var e errs.ApiError
+	var se jsonutil.StreamError
+	var mbe *http.MaxBytesError
+	if errors.As(err, &se) {
+		// the status line is already on the wire, nothing left to render
+		log.Printf("%sSTREAM ERROR%s: %s", colorRed, colorReset, se.Error())
+	} else if errors.As(err, &e) {
+		jsonutil.Write(w, e.StatusCode, withTraceID(r, e.Map()))
+		log.Printf("%sAPI ERROR%s: %s", colorRed, colorReset, e.Log)
+	} else if errors.As(err, &mbe) {
+		e = errs.RequestTooLarge(mbe.Limit)
+		jsonutil.Write(w, e.StatusCode, withTraceID(r, e.Map()))
+		log.Printf("%sAPI ERROR%s: %s", colorRed, colorReset, e.Log)
+	} else if errors.Is(err, context.DeadlineExceeded) && r.Context().Err() != nil {
+		e = errs.Timeout(err.Error())
+		jsonutil.Write(w, e.StatusCode, withTraceID(r, e.Map()))
+		log.Printf("%sTIMEOUT%s: %s %s: %s", colorRed, colorReset, r.Method, r.URL.Path, e.Log)
+	} else {
+		jsonutil.Write(w, http.StatusInternalServerError, withTraceID(r, map[string]string{
+			"error": "internal server error",
+		}))
+		log.Printf("%sUNKNOWN ERROR%s: %s", colorRed, colorReset, err.Error())
+	}
+}
+
+// withTraceID lets clients quote the trace when reporting a failed request.
+func withTraceID(r *http.Request, body map[string]string) map[string]string {
+	if id := cctx.TraceID(r.Context()); id != "" {
+		body["trace_id"] = id
+	}
+	return body
+}
+
 func RealIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip := func(r *http.Request) string {
@@ -127,6 +167,30 @@ func RealIP(next http.Handler) http.Handler {
 	})
 }
 
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID keeps the caller's X-Request-ID (or generates one), stores it
+// through cctx and echoes it on the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			var b [12]byte
+			rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(
+			context.WithValue(r.Context(), cctx.RequestIDKey, id)),
+		)
+	})
+}
+
+func IsInternal(r *http.Request) bool {
+	ip := cctx.RealIP(r.Context())
+	return strings.HasPrefix(ip, "192.168.") || strings.HasPrefix(ip, "10.")
+}
+
 func Internal(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip, _ := r.Context().Value(cctx.RealIpKey).(string)
@@ -134,7 +198,7 @@ func Internal(next http.Handler) http.Handler {
 			log.Printf("Internal route ‑ caller IP: %s", ip)
 		}
 
-		if !strings.HasPrefix(ip, "192.168.") && !strings.HasPrefix(ip, "10.") {
+		if !IsInternal(r) {
 			_ = jsonutil.Write(w, http.StatusForbidden, map[string]string{
 				"error": "forbidden",
 			})
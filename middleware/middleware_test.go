@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/mwdev22/rest/cctx"
+	"github.com/mwdev22/rest/jsonutil"
 	"github.com/mwdev22/rest/utils/errs"
 )
 
@@ -68,6 +69,16 @@ func TestWrap(t *testing.T) {
 			checkJSON:      true,
 			expectedError:  "not found",
 		},
+		{
+			name: "stream error - response already committed",
+			handler: func(w http.ResponseWriter, r *http.Request) error {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("partial"))
+				return jsonutil.StreamError{Err: errors.New("client gone")}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "partial",
+		},
 		{
 			name: "generic error",
 			handler: func(w http.ResponseWriter, r *http.Request) error {
@@ -108,6 +119,25 @@ func TestWrap(t *testing.T) {
 	}
 }
 
+func TestWrapTraceID(t *testing.T) {
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return errs.NotFound("object not found")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), cctx.TraceIDKey, "4bf92f3577b34da6a3ce929d0e0e4736"))
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var response map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace_id in body, got %v", response)
+	}
+}
+
 func TestRealIP(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -164,6 +194,40 @@ func TestRealIP(t *testing.T) {
 	}
 }
 
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "keeps caller id", incoming: "abc-123", keep: true},
+		{name: "generates when missing", incoming: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = cctx.RequestID(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if seen == "" || w.Header().Get(RequestIDHeader) != seen {
+				t.Errorf("expected id in context and response, got %q and %q", seen, w.Header().Get(RequestIDHeader))
+			}
+			if tt.keep && seen != tt.incoming {
+				t.Errorf("expected %s, got %s", tt.incoming, seen)
+			}
+		})
+	}
+}
+
 func TestInternal(t *testing.T) {
 	tests := []struct {
 		name           string
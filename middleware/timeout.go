@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+// Timeout gives each request a deadline of d. If the handler has not started
+// writing when it expires, a 504 ApiError is rendered the same way Wrap does
+// and anything the handler writes afterwards is discarded
+// (Write returns http.ErrHandlerTimeout). The middleware only returns once the
+// handler does, so handlers must honour ctx to free the connection. The
+// timeout is logged with the matched route pattern when the handler returns.
+func Timeout(d time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// re-panic on the serving goroutine so Recoverer sees it
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if !tw.wroteHeader {
+					// nothing written, net/http sends 200 with whatever headers were set
+					maps.Copy(w.Header(), tw.h)
+				}
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true
+				deadline := ctx.Err() == context.DeadlineExceeded
+				if deadline {
+					if !tw.wroteHeader {
+						RenderError(w, r, errs.Timeout(fmt.Sprintf("deadline of %s exceeded", d)))
+					}
+					// send the 504 now rather than after the handler gives up
+					http.NewResponseController(w).Flush()
+				}
+				tw.mu.Unlock()
+
+				// The handler still holds r and its pooled chi route context,
+				// which is reused as soon as we return, so wait for it. Once it
+				// is done routing has finished and the pattern can be read,
+				// also when Timeout runs before chi matched the route.
+				select {
+				case <-done:
+					if deadline {
+						log.Printf("%sTIMEOUT%s: %s %s exceeded %s", colorRed, colorReset, r.Method, routeOf(r), d)
+					}
+				case p := <-panicked:
+					log.Printf("%sPANIC%s after timeout: %s %s: %v", colorRed, colorReset, r.Method, routeOf(r), p)
+				}
+			}
+		})
+	}
+}
+
+func routeOf(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return r.URL.Path
+}
+
+// timeoutWriter keeps its own header map so a handler still running after the
+// timeout never touches the real response.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	dst := tw.w.Header()
+	clear(dst)
+	maps.Copy(dst, tw.h)
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// Flush keeps streaming handlers working under a timeout.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	http.NewResponseController(tw.w).Flush()
+}
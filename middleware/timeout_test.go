@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTimeout(t *testing.T) {
+	late := make(chan error, 1)
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+		expectedError  string
+		expectedBody   string
+		expectedHeader string
+	}{
+		{
+			name: "fast handler untouched",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Custom", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			},
+			expectedStatus: http.StatusCreated,
+			expectedBody:   "created",
+			expectedHeader: "yes",
+		},
+		{
+			name: "headers kept without body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Custom", "yes")
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "yes",
+		},
+		{
+			name: "slow handler gets 504 and late write is blocked",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				time.Sleep(10 * time.Millisecond)
+				w.Header().Set("X-Custom", "late")
+				_, err := w.Write([]byte("too late"))
+				late <- err
+			},
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedError:  "request timeout",
+		},
+		{
+			name: "wrapped handler returning ctx error",
+			handler: Wrap(func(w http.ResponseWriter, r *http.Request) error {
+				<-r.Context().Done()
+				return r.Context().Err()
+			}),
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedError:  "request timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.With(Timeout(30*time.Millisecond)).Get("/items/{id}", tt.handler)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedError != "" {
+				var response map[string]string
+				if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if response["error"] != tt.expectedError {
+					t.Errorf("expected error message '%s', got '%s'", tt.expectedError, response["error"])
+				}
+			} else if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body '%s', got '%s'", tt.expectedBody, w.Body.String())
+			}
+			if w.Header().Get("X-Custom") != tt.expectedHeader {
+				t.Errorf("expected X-Custom '%s', got '%s'", tt.expectedHeader, w.Header().Get("X-Custom"))
+			}
+		})
+	}
+
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Errorf("expected ErrHandlerTimeout for late write, got %v", err)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	handler := Recoverer(Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
+
+func TestTimeoutWaitsForHandler(t *testing.T) {
+	params := make(chan string, 2)
+	r := chi.NewRouter()
+	r.With(Timeout(20*time.Millisecond)).Get("/reports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		// still this request's params, the route context wasn't recycled
+		params <- chi.URLParam(r, "id")
+	})
+	r.Get("/other/{name}", func(w http.ResponseWriter, r *http.Request) {})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reports/42", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected middleware to wait for the handler, returned after %s", elapsed)
+	}
+	for range 10 {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other/x", nil))
+	}
+
+	if got := <-params; got != "42" {
+		t.Errorf("expected id 42 in late handler, got %q", got)
+	}
+}
+
+func TestTimeoutLogsRoutePattern(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// mounted with Use, before chi has matched the route
+	r := chi.NewRouter()
+	r.Use(Timeout(10 * time.Millisecond))
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/42", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", w.Code)
+	}
+	if !strings.Contains(buf.String(), "GET /items/{id} exceeded") {
+		t.Errorf("expected timeout logged with the route pattern, got %q", buf.String())
+	}
+}
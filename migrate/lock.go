@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mwdev22/rest/db"
+	"github.com/mwdev22/rest/query"
+)
+
+// Locker takes a lock on conn that other replicas wait for, released by the
+// returned func.
+type Locker interface {
+	Lock(ctx context.Context, conn *sql.Conn) (unlock func() error, err error)
+}
+
+type LockerFunc func(ctx context.Context, conn *sql.Conn) (func() error, error)
+
+func (f LockerFunc) Lock(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	return f(ctx, conn)
+}
+
+// PostgresLock uses a session advisory lock, released with the connection if
+// the process dies.
+func PostgresLock(key int64) Locker {
+	return LockerFunc(func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+			return nil, err
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+			return err
+		}, nil
+	})
+}
+
+// MySQLLock uses GET_LOCK, released with the connection if the process dies.
+func MySQLLock(name string) Locker {
+	return LockerFunc(func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", name).Scan(&ok); err != nil {
+			return nil, err
+		}
+		if ok.Int64 != 1 {
+			return nil, fmt.Errorf("GET_LOCK(%s) failed", name)
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+			return err
+		}, nil
+	})
+}
+
+// TableLock works on any database, SQLite included, by inserting a single
+// row. A lock older than ttl (15 minutes by default) is taken to belong to a
+// crashed replica and broken, so keep ttl above the longest migration.
+func TableLock(table string, ph query.Placeholder, ttl time.Duration) Locker {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return LockerFunc(func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id         INTEGER PRIMARY KEY,
+			expires_at BIGINT  NOT NULL
+		)`, table))
+		if err != nil {
+			return nil, err
+		}
+		for {
+			now := time.Now()
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at < %s", table, ph(1)), now.UnixMilli()); err != nil {
+				return nil, err
+			}
+			_, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, expires_at) VALUES (1, %s)", table, ph(1)), now.Add(ttl).UnixMilli())
+			if err == nil {
+				return func() error {
+					_, err := conn.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+					return err
+				}, nil
+			}
+			if !db.IsUniqueViolation(err) {
+				return nil, err
+			}
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	})
+}
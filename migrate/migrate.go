@@ -0,0 +1,315 @@
+// Package migrate applies versioned SQL migrations embedded in the binary.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mwdev22/rest/db"
+	"github.com/mwdev22/rest/query"
+)
+
+var ErrChecksumMismatch = errors.New("migrate: applied migration was modified")
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Options struct {
+	// Dir inside the FS holding the files, "." by default.
+	Dir string
+	// Table recording applied versions, "schema_migrations" by default.
+	Table       string
+	Placeholder query.Placeholder
+	// Lock keeps other replicas out while migrating, a lock table by default.
+	Lock Locker
+	// DryRun logs what would run, only the bookkeeping tables get created.
+	DryRun bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	opts       Options
+	migrations []Migration
+}
+
+// Status of one migration, from the files and the table.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Changed means the file no longer matches what was applied.
+	Changed bool
+	// Missing means the version was applied but its file is gone, e.g. by a
+	// newer release.
+	Missing bool
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// New reads <version>_<name>.up.sql and optional .down.sql files from fsys.
+// Each file runs as one Exec, so MySQL needs multiStatements=true.
+func New(pool *sql.DB, fsys fs.FS, opts Options) (*Migrator, error) {
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	if opts.Table == "" {
+		opts.Table = "schema_migrations"
+	}
+	if opts.Placeholder == nil {
+		opts.Placeholder = query.Question
+	}
+	if opts.Lock == nil {
+		opts.Lock = TableLock(opts.Table+"_lock", opts.Placeholder, 0)
+	}
+
+	entries, err := fs.ReadDir(fsys, opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		match := fileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: %s doesn't match <version>_<name>.(up|down).sql", e.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		b, err := fs.ReadFile(fsys, path.Join(opts.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+			sum := sha256.Sum256(b)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	mg := &Migrator{db: pool, opts: opts}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up file", m.Version)
+		}
+		mg.migrations = append(mg.migrations, *m)
+	}
+	slices.SortFunc(mg.migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return mg, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Up applies pending migrations in version order, each in a transaction with
+// its version row. It refuses to run when an applied file was modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]appliedRow) error {
+		for _, mg := range m.migrations {
+			if row, ok := applied[mg.Version]; ok && row.checksum != mg.Checksum {
+				return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, mg.Version, mg.Name)
+			}
+		}
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if m.opts.DryRun {
+				log.Printf("migrate: would apply %d_%s", mg.Version, mg.Name)
+				done = append(done, mg)
+				continue
+			}
+			start := time.Now()
+			err := inTx(ctx, conn, mg.Up, fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)",
+				m.opts.Table, m.ph(1), m.ph(2), m.ph(3), m.ph(4)), mg.Version, mg.Name, mg.Checksum, time.Now().UnixMilli())
+			if err != nil {
+				return fmt.Errorf("migrate: %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			log.Printf("migrate: applied %d_%s in %s", mg.Version, mg.Name, time.Since(start).Round(time.Millisecond))
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]appliedRow) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("migrate: %d_%s has no down file", mg.Version, mg.Name)
+			}
+			if m.opts.DryRun {
+				log.Printf("migrate: would roll back %d_%s", mg.Version, mg.Name)
+				done = append(done, mg)
+				continue
+			}
+			err := inTx(ctx, conn, mg.Down, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.opts.Table, m.ph(1)), mg.Version)
+			if err != nil {
+				return fmt.Errorf("migrate: rolling back %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			log.Printf("migrate: rolled back %d_%s", mg.Version, mg.Name)
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists known and applied migrations by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, mg := range m.migrations {
+		st := Status{Version: mg.Version, Name: mg.Name}
+		if row, ok := applied[mg.Version]; ok {
+			st.Applied, st.AppliedAt, st.Changed = true, row.appliedAt, row.checksum != mg.Checksum
+			delete(applied, mg.Version)
+		}
+		out = append(out, st)
+	}
+	for version, row := range applied {
+		out = append(out, Status{Version: version, Name: row.name, Applied: true, AppliedAt: row.appliedAt, Missing: true})
+	}
+	slices.SortFunc(out, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+	return out, nil
+}
+
+// Pending reports whether any known migration isn't applied yet.
+func (m *Migrator) Pending(ctx context.Context) (bool, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(status, func(s Status) bool { return !s.Applied }), nil
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// locked runs fn holding the lock, with the applied versions read after
+// acquiring it so a replica that waited sees the other's work. Everything
+// runs on the locked connection, a pool of one (SQLite) doesn't deadlock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]appliedRow) error) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.opts.Lock.Lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			log.Printf("migrate: unlock: %v", err)
+		}
+	}()
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version    BIGINT       PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		checksum   VARCHAR(64)  NOT NULL,
+		applied_at BIGINT       NOT NULL
+	)`, m.opts.Table))
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, q db.Querier) (map[int64]appliedRow, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s", m.opts.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]appliedRow{}
+	for rows.Next() {
+		var (
+			version int64
+			row     appliedRow
+			millis  int64
+		)
+		if err := rows.Scan(&version, &row.name, &row.checksum, &millis); err != nil {
+			return nil, err
+		}
+		row.appliedAt = time.UnixMilli(millis)
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// inTx runs a migration script and its bookkeeping statement together.
+func inTx(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) ph(n int) string {
+	return m.opts.Placeholder(n)
+}
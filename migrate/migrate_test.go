@@ -0,0 +1,241 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mwdev22/rest/query"
+	_ "modernc.org/sqlite"
+)
+
+func openTest(t *testing.T) *sql.DB {
+	t.Helper()
+	pool, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetMaxOpenConns(1)
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/1_users.up.sql":    {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);")},
+		"migrations/1_users.down.sql":  {Data: []byte("DROP TABLE users;")},
+		"migrations/2_orders.up.sql":   {Data: []byte("CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL);")},
+		"migrations/2_orders.down.sql": {Data: []byte("DROP TABLE orders;")},
+		"migrations/README.md":         {Data: []byte("ignored")},
+	}
+}
+
+func tables(t *testing.T, pool *sql.DB) map[string]bool {
+	t.Helper()
+	rows, err := pool.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		out[name] = true
+	}
+	return out
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	pool := openTest(t)
+	m, err := New(pool, testFS(), Options{Dir: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("expected 2 migrations applied, got %d and %v", len(done), err)
+	}
+	if got := tables(t, pool); !got["users"] || !got["orders"] {
+		t.Errorf("expected users and orders tables, got %v", got)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("expected second Up to be a no-op, got %d and %v", len(done), err)
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("expected version 2 rolled back, got %v and %v", done, err)
+	}
+	if got := tables(t, pool); !got["users"] || got["orders"] {
+		t.Errorf("expected only users table left, got %v", got)
+	}
+	if pending, _ := m.Pending(ctx); !pending {
+		t.Error("expected version 2 pending after Down")
+	}
+}
+
+func TestUpFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	pool := openTest(t)
+	fsys := testFS()
+	fsys["migrations/3_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY); SELECT * FROM missing;")}
+	m, err := New(pool, fsys, Options{Dir: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(ctx)
+	if err == nil || len(done) != 2 {
+		t.Fatalf("expected failure after 2 migrations, got %d and %v", len(done), err)
+	}
+	if tables(t, pool)["tags"] {
+		t.Error("expected failed migration to roll back")
+	}
+	status, _ := m.Status(ctx)
+	if len(status) != 3 || status[2].Applied {
+		t.Errorf("expected version 3 not applied, got %+v", status)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	pool := openTest(t)
+	m, err := New(pool, testFS(), Options{Dir: "migrations", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("expected 2 migrations reported, got %d and %v", len(done), err)
+	}
+	if tables(t, pool)["users"] {
+		t.Error("expected dry run to leave the schema alone")
+	}
+	if pending, _ := m.Pending(ctx); !pending {
+		t.Error("expected migrations still pending after dry run")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	pool := openTest(t)
+	fsys := testFS()
+	m, _ := New(pool, fsys, Options{Dir: "migrations"})
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a newer release dropped version 2 and someone edited version 1
+	delete(fsys, "migrations/2_orders.up.sql")
+	delete(fsys, "migrations/2_orders.down.sql")
+	fsys["migrations/1_users.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")}
+	fsys["migrations/3_tags.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY);")}
+	m, err := New(pool, fsys, Options{Dir: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Status{
+		{Version: 1, Name: "users", Applied: true, Changed: true},
+		{Version: 2, Name: "orders", Applied: true, Missing: true},
+		{Version: 3, Name: "tags"},
+	}
+	if len(status) != len(expected) {
+		t.Fatalf("expected %d rows, got %+v", len(expected), status)
+	}
+	for i, st := range status {
+		if st.Applied && st.AppliedAt.IsZero() {
+			t.Errorf("expected applied_at for version %d", st.Version)
+		}
+		st.AppliedAt = time.Time{}
+		if st != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], st)
+		}
+	}
+
+	if _, err := m.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if tables(t, pool)["tags"] {
+		t.Error("expected nothing applied after a checksum mismatch")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "bad name", fsys: fstest.MapFS{"create_users.sql": {Data: []byte("SELECT 1")}}},
+		{name: "down only", fsys: fstest.MapFS{"1_users.down.sql": {Data: []byte("SELECT 1")}}},
+		{name: "duplicate version", fsys: fstest.MapFS{
+			"1_users.up.sql":  {Data: []byte("SELECT 1")},
+			"1_orders.up.sql": {Data: []byte("SELECT 1")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(nil, tt.fsys, Options{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTableLock(t *testing.T) {
+	ctx := context.Background()
+	pool, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	lock := TableLock("migrate_lock", query.Question, time.Minute)
+
+	conn1, _ := pool.Conn(ctx)
+	defer conn1.Close()
+	unlock, err := lock.Lock(ctx, conn1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn2, _ := pool.Conn(ctx)
+	defer conn2.Close()
+	waitCtx, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+	defer cancel()
+	if _, err := lock.Lock(waitCtx, conn2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected second locker to wait, got %v", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock2, err := lock.Lock(ctx, conn2)
+	if err != nil {
+		t.Errorf("expected lock after release, got %v", err)
+	} else {
+		unlock2()
+	}
+
+	// a lock left by a crashed replica is broken once expired
+	expired := TableLock("migrate_lock", query.Question, time.Nanosecond)
+	if _, err := expired.Lock(ctx, conn1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := expired.Lock(ctx, conn2); err != nil {
+		t.Errorf("expected expired lock to be broken, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package outbox records domain events in the transaction of the change that
+// caused them and publishes them from a background worker.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mwdev22/rest/cctx"
+	"github.com/mwdev22/rest/db"
+	"github.com/mwdev22/rest/query"
+)
+
+// ErrNoTx is returned by Add outside of db.InTx, an event written on its own
+// could be published for a change that was rolled back.
+var ErrNoTx = errors.New("outbox: Add must run inside a transaction")
+
+// errLeaseLost means another worker took over an expired lease.
+var errLeaseLost = errors.New("outbox: lease lost")
+
+type Event struct {
+	ID int64 `json:"id"`
+	// Aggregate identifies the entity the event belongs to, e.g. "order:42".
+	// Events of one aggregate are published in the order they were added.
+	Aggregate string          `json:"aggregate"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	// Attempts made before this one.
+	Attempts int `json:"-"`
+
+	// lease is the locked_until written by the claim, it identifies the
+	// worker holding the event.
+	lease int64
+}
+
+// Outbox keeps events in a table shared by all instances:
+//
+//	CREATE TABLE outbox (
+//		id              INTEGER      PRIMARY KEY, -- BIGSERIAL on PostgreSQL
+//		aggregate       VARCHAR(255) NOT NULL,
+//		type            VARCHAR(255) NOT NULL,
+//		payload         TEXT         NOT NULL,
+//		created_at      BIGINT       NOT NULL,
+//		attempts        INTEGER      NOT NULL DEFAULT 0,
+//		next_attempt_at BIGINT       NOT NULL DEFAULT 0,
+//		locked_until    BIGINT       NOT NULL DEFAULT 0,
+//		last_error      TEXT,
+//		sent_at         BIGINT,
+//		failed_at       BIGINT
+//	);
+//	CREATE INDEX outbox_pending ON outbox (aggregate, id) WHERE sent_at IS NULL AND failed_at IS NULL;
+type Outbox struct {
+	db    *db.DB
+	table string
+	ph    query.Placeholder
+}
+
+func New(d *db.DB, table string, ph query.Placeholder) *Outbox {
+	return &Outbox{db: d, table: table, ph: ph}
+}
+
+// Add writes an event in the transaction carried by ctx, it is published
+// only if that transaction commits. payload is encoded as JSON unless it
+// already is a json.RawMessage.
+func (o *Outbox) Add(ctx context.Context, aggregate, typ string, payload any) error {
+	tx := cctx.Tx(ctx)
+	if tx == nil {
+		return ErrNoTx
+	}
+	raw, ok := payload.(json.RawMessage)
+	if !ok {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("outbox: encode %s payload: %w", typ, err)
+		}
+		raw = b
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (aggregate, type, payload, created_at) VALUES (%s, %s, %s, %s)",
+		o.table, o.ph(1), o.ph(2), o.ph(3), o.ph(4)), aggregate, typ, string(raw), time.Now().UnixMilli())
+	return err
+}
+
+// Purge deletes events sent before the given time.
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := o.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE sent_at < %s", o.table, o.ph(1)), before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// claim leases up to limit pending events in id order. Aggregates with an
+// event waiting for a retry or leased by another worker are left out
+// entirely, so no event overtakes an earlier one of the same aggregate.
+func (o *Outbox) claim(ctx context.Context, limit int, lease time.Duration) ([]Event, error) {
+	var claimed []Event
+	err := o.db.InTx(ctx, func(ctx context.Context) error {
+		claimed = nil
+		now := time.Now().UnixMilli()
+		rows, err := o.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, aggregate, type, payload, created_at, attempts FROM %[1]s
+			WHERE sent_at IS NULL AND failed_at IS NULL AND aggregate NOT IN (
+				SELECT aggregate FROM %[1]s
+				WHERE sent_at IS NULL AND failed_at IS NULL AND (next_attempt_at > %[2]s OR locked_until > %[3]s)
+			)
+			ORDER BY id LIMIT %[4]s`, o.table, o.ph(1), o.ph(2), o.ph(3)), now, now, limit)
+		if err != nil {
+			return err
+		}
+		var events []Event
+		for rows.Next() {
+			var (
+				e       Event
+				payload string
+				created int64
+			)
+			if err := rows.Scan(&e.ID, &e.Aggregate, &e.Type, &payload, &created, &e.Attempts); err != nil {
+				rows.Close()
+				return err
+			}
+			e.Payload, e.CreatedAt = json.RawMessage(payload), time.UnixMilli(created)
+			events = append(events, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Another worker may have leased the same rows since the SELECT. Its
+		// lease wins and the rest of that aggregate is skipped as well.
+		lost := map[string]bool{}
+		for _, e := range events {
+			if lost[e.Aggregate] {
+				continue
+			}
+			res, err := o.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET locked_until = %s WHERE id = %s AND sent_at IS NULL AND locked_until <= %s",
+				o.table, o.ph(1), o.ph(2), o.ph(3)), now+lease.Milliseconds(), e.ID, now)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				lost[e.Aggregate] = true
+				continue
+			}
+			e.lease = now + lease.Milliseconds()
+			claimed = append(claimed, e)
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// renew moves the lease of events still held under lease to until, failing
+// unless all of them are.
+func (o *Outbox) renew(ctx context.Context, events []Event, lease, until int64) error {
+	ids := make([]string, len(events))
+	args := []any{until, lease}
+	for i, e := range events {
+		ids[i] = o.ph(i + 3)
+		args = append(args, e.ID)
+	}
+	res, err := o.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET locked_until = %s WHERE locked_until = %s AND id IN (%s)",
+		o.table, o.ph(1), o.ph(2), strings.Join(ids, ", ")), args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != int64(len(events)) {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// The marks below only touch an event still held under the worker's lease.
+
+func (o *Outbox) markSent(ctx context.Context, e Event) error {
+	return o.leased(ctx, fmt.Sprintf("UPDATE %s SET sent_at = %s, attempts = attempts + 1, locked_until = 0 WHERE id = %s AND locked_until = %s",
+		o.table, o.ph(1), o.ph(2), o.ph(3)), time.Now().UnixMilli(), e.ID, e.lease)
+}
+
+func (o *Outbox) markRetry(ctx context.Context, e Event, next time.Time, cause error) error {
+	return o.leased(ctx, fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, next_attempt_at = %s, last_error = %s, locked_until = 0 WHERE id = %s AND locked_until = %s",
+		o.table, o.ph(1), o.ph(2), o.ph(3), o.ph(4)), next.UnixMilli(), cause.Error(), e.ID, e.lease)
+}
+
+func (o *Outbox) markFailed(ctx context.Context, e Event, cause error) error {
+	return o.leased(ctx, fmt.Sprintf("UPDATE %s SET failed_at = %s, attempts = attempts + 1, last_error = %s, locked_until = 0 WHERE id = %s AND locked_until = %s",
+		o.table, o.ph(1), o.ph(2), o.ph(3), o.ph(4)), time.Now().UnixMilli(), cause.Error(), e.ID, e.lease)
+}
+
+func (o *Outbox) release(ctx context.Context, e Event) error {
+	return o.leased(ctx, fmt.Sprintf("UPDATE %s SET locked_until = 0 WHERE id = %s AND locked_until = %s",
+		o.table, o.ph(1), o.ph(2)), e.ID, e.lease)
+}
+
+func (o *Outbox) leased(ctx context.Context, stmt string, args ...any) error {
+	res, err := o.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/db"
+	"github.com/mwdev22/rest/idempotency"
+	"github.com/mwdev22/rest/query"
+	_ "modernc.org/sqlite"
+)
+
+func openTest(t *testing.T) (*db.DB, *Outbox) {
+	t.Helper()
+	d, err := db.Open(context.Background(), "sqlite", filepath.Join(t.TempDir(), "test.db"), db.Options{MaxOpenConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	_, err = d.ExecContext(context.Background(), `
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER NOT NULL);
+		CREATE TABLE outbox (
+			id              INTEGER      PRIMARY KEY,
+			aggregate       VARCHAR(255) NOT NULL,
+			type            VARCHAR(255) NOT NULL,
+			payload         TEXT         NOT NULL,
+			created_at      BIGINT       NOT NULL,
+			attempts        INTEGER      NOT NULL DEFAULT 0,
+			next_attempt_at BIGINT       NOT NULL DEFAULT 0,
+			locked_until    BIGINT       NOT NULL DEFAULT 0,
+			last_error      TEXT,
+			sent_at         BIGINT,
+			failed_at       BIGINT
+		);
+		CREATE INDEX outbox_pending ON outbox (aggregate, id) WHERE sent_at IS NULL AND failed_at IS NULL;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, New(d, "outbox", query.Question)
+}
+
+func add(t *testing.T, d *db.DB, o *Outbox, events ...[2]string) {
+	t.Helper()
+	err := d.InTx(context.Background(), func(ctx context.Context) error {
+		for _, e := range events {
+			if err := o.Add(ctx, e[0], e[1], map[string]string{"type": e[1]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func types(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.Aggregate+" "+e.Type)
+	}
+	return out
+}
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	d, o := openTest(t)
+	pub := NewMemoryPublisher()
+	w := NewWorker(o, pub, WorkerOptions{})
+
+	if err := o.Add(ctx, "order:1", "created", nil); !errors.Is(err, ErrNoTx) {
+		t.Errorf("expected ErrNoTx outside a transaction, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	err := d.InTx(ctx, func(ctx context.Context) error {
+		d.ExecContext(ctx, "INSERT INTO orders (id, total) VALUES (1, 100)")
+		o.Add(ctx, "order:1", "created", map[string]int{"total": 100})
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected rollback, got %v", err)
+	}
+	err = d.InTx(ctx, func(ctx context.Context) error {
+		if _, err := d.ExecContext(ctx, "INSERT INTO orders (id, total) VALUES (2, 200)"); err != nil {
+			return err
+		}
+		return o.Add(ctx, "order:2", "created", map[string]int{"total": 200})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := w.Poll(ctx); n != 1 || err != nil {
+		t.Fatalf("expected 1 event, got %d and %v", n, err)
+	}
+	events := pub.Events()
+	if len(events) != 1 || events[0].Aggregate != "order:2" || string(events[0].Payload) != `{"total":200}` {
+		t.Errorf("expected only the committed event, got %+v", events)
+	}
+	if n, _ := w.Poll(ctx); n != 0 {
+		t.Errorf("expected sent event not to be claimed again, got %d", n)
+	}
+}
+
+func TestRetryKeepsAggregateOrder(t *testing.T) {
+	ctx := context.Background()
+	d, o := openTest(t)
+	pub := NewMemoryPublisher()
+	failing := true
+	pub.Subscribe(func(ctx context.Context, e Event) error {
+		if failing && e.Aggregate == "a" && e.Type == "1" {
+			return errors.New("broker down")
+		}
+		return nil
+	})
+	w := NewWorker(o, pub, WorkerOptions{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	add(t, d, o, [2]string{"a", "1"}, [2]string{"b", "1"}, [2]string{"a", "2"}, [2]string{"b", "2"})
+
+	if _, err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := types(pub.Events()); !reflect.DeepEqual(got, []string{"b 1", "b 2"}) {
+		t.Errorf("expected a to wait for its failed event, got %v", got)
+	}
+
+	// new events of a still queue behind the one waiting for a retry
+	add(t, d, o, [2]string{"a", "3"})
+	failing = false
+	time.Sleep(5 * time.Millisecond)
+	if _, err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := types(pub.Events()); !reflect.DeepEqual(got, []string{"b 1", "b 2", "a 1", "a 2", "a 3"}) {
+		t.Errorf("expected a published in order after the retry, got %v", got)
+	}
+
+	var attempts int
+	var lastErr string
+	d.QueryRowContext(ctx, "SELECT attempts, last_error FROM outbox WHERE aggregate = 'a' AND type = '1'").Scan(&attempts, &lastErr)
+	if attempts != 2 || lastErr != "broker down" {
+		t.Errorf("expected 2 attempts and the last error, got %d %q", attempts, lastErr)
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		maxAttempts int
+		polls       int
+	}{
+		{name: "permanent", err: Permanent(errors.New("bad event")), polls: 1},
+		{name: "max attempts", err: errors.New("broker down"), maxAttempts: 2, polls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			d, o := openTest(t)
+			pub := NewMemoryPublisher()
+			pub.Subscribe(func(ctx context.Context, e Event) error {
+				if e.Type == "1" {
+					return tt.err
+				}
+				return nil
+			})
+			w := NewWorker(o, pub, WorkerOptions{MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+			add(t, d, o, [2]string{"a", "1"}, [2]string{"a", "2"})
+
+			for range tt.polls {
+				time.Sleep(2 * time.Millisecond)
+				w.Poll(ctx)
+			}
+
+			if got := types(pub.Events()); !reflect.DeepEqual(got, []string{"a 2"}) {
+				t.Errorf("expected the next event to move on, got %v", got)
+			}
+			var failed int
+			d.QueryRowContext(ctx, "SELECT COUNT(*) FROM outbox WHERE failed_at IS NOT NULL").Scan(&failed)
+			if failed != 1 {
+				t.Errorf("expected 1 failed event, got %d", failed)
+			}
+		})
+	}
+}
+
+func TestClaimLease(t *testing.T) {
+	ctx := context.Background()
+	d, o := openTest(t)
+	add(t, d, o, [2]string{"a", "1"}, [2]string{"b", "1"})
+
+	first, err := o.claim(ctx, 1, time.Minute)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("expected 1 claimed event, got %v and %v", first, err)
+	}
+	add(t, d, o, [2]string{"a", "2"})
+
+	second, err := o.claim(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types(second); !reflect.DeepEqual(got, []string{"b 1"}) {
+		t.Errorf("expected leased aggregate to be skipped, got %v", got)
+	}
+
+	// an expired lease is taken over
+	d.ExecContext(ctx, "UPDATE outbox SET locked_until = 1")
+	third, _ := o.claim(ctx, 10, time.Minute)
+	if got := types(third); !reflect.DeepEqual(got, []string{"a 1", "b 1", "a 2"}) {
+		t.Errorf("expected expired leases to be claimed again, got %v", got)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	d, o := openTest(t)
+	pub := NewMemoryPublisher()
+	pub.Subscribe(func(ctx context.Context, e Event) error {
+		// another worker took over the expired lease meanwhile
+		_, err := d.ExecContext(ctx, "UPDATE outbox SET locked_until = ?", time.Now().Add(time.Hour).UnixMilli())
+		return err
+	})
+	w := NewWorker(o, pub, WorkerOptions{})
+	add(t, d, o, [2]string{"a", "1"}, [2]string{"a", "2"})
+
+	if _, err := w.Poll(ctx); !errors.Is(err, errLeaseLost) {
+		t.Errorf("expected errLeaseLost, got %v", err)
+	}
+	if got := types(pub.Events()); !reflect.DeepEqual(got, []string{"a 1"}) {
+		t.Errorf("expected the group to stop after losing the lease, got %v", got)
+	}
+	var sent int
+	d.QueryRowContext(ctx, "SELECT COUNT(*) FROM outbox WHERE sent_at IS NOT NULL").Scan(&sent)
+	if sent != 0 {
+		t.Errorf("expected events left to the new owner, got %d marked sent", sent)
+	}
+}
+
+func TestLeaseRenewed(t *testing.T) {
+	ctx := context.Background()
+	d, o := openTest(t)
+	pub := NewMemoryPublisher()
+	var claimedMeanwhile []Event
+	pub.Subscribe(func(ctx context.Context, e Event) error {
+		if e.Type == "7" {
+			// the first lease has expired by now
+			claimedMeanwhile, _ = o.claim(ctx, 10, time.Minute)
+		}
+		time.Sleep(12 * time.Millisecond)
+		return nil
+	})
+	w := NewWorker(o, pub, WorkerOptions{Timeout: 20 * time.Millisecond, Lease: 60 * time.Millisecond})
+	for i := 1; i <= 7; i++ {
+		add(t, d, o, [2]string{"a", string(rune('0' + i))})
+	}
+
+	if _, err := w.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(claimedMeanwhile) != 0 {
+		t.Errorf("expected renewed lease to keep other workers out, they claimed %v", types(claimedMeanwhile))
+	}
+	if n := len(pub.Events()); n != 7 {
+		t.Errorf("expected 7 events published, got %d", n)
+	}
+}
+
+func TestWorkerStart(t *testing.T) {
+	d, o := openTest(t)
+	pub := NewMemoryPublisher()
+	published := make(chan struct{}, 1)
+	pub.Subscribe(func(ctx context.Context, e Event) error {
+		published <- struct{}{}
+		return nil
+	})
+	w := NewWorker(o, pub, WorkerOptions{PollInterval: 5 * time.Millisecond})
+	w.Start()
+
+	add(t, d, o, [2]string{"a", "1"})
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("expected event to be published by the background worker")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		got  *http.Request
+		body []byte
+	)
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	pub := NewWebhookPublisher(srv.URL, WebhookOptions{Secret: "s3cret", Header: http.Header{"Authorization": {"Bearer t"}}})
+	e := Event{ID: 7, Aggregate: "order:1", Type: "order.created", Payload: json.RawMessage(`{"total":100}`), CreatedAt: time.UnixMilli(1000)}
+
+	if err := pub.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got.Header.Get(EventIDHeader) != "7" || got.Header.Get(EventTypeHeader) != "order.created" ||
+		got.Header.Get("Idempotency-Key") != "outbox-7" || got.Header.Get("Authorization") != "Bearer t" {
+		t.Errorf("expected event headers, got %v", got.Header)
+	}
+	if sig := got.Header.Get(SignatureHeader); sig != "sha256="+Sign("s3cret", got.Header.Get(TimestampHeader), body) {
+		t.Errorf("expected valid signature, got %q", sig)
+	}
+	var decoded Event
+	if err := json.Unmarshal(body, &decoded); err != nil || decoded.ID != 7 || string(decoded.Payload) != `{"total":100}` {
+		t.Errorf("expected event as JSON, got %s", body)
+	}
+
+	tests := []struct {
+		status            int
+		expectedPermanent bool
+	}{
+		{status: http.StatusBadRequest, expectedPermanent: true},
+		{status: http.StatusConflict},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		mu.Unlock()
+		err := pub.Publish(context.Background(), e)
+		if err == nil || IsPermanent(err) != tt.expectedPermanent {
+			t.Errorf("status %d: expected permanent=%v, got %v", tt.status, tt.expectedPermanent, err)
+		}
+		mu.Lock()
+	}
+}
+
+func TestWebhookPublisherIdempotentReceiver(t *testing.T) {
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	receiver := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	pub := NewWebhookPublisher(srv.URL, WebhookOptions{})
+	e := Event{ID: 9, Aggregate: "order:1", Type: "order.created", Payload: json.RawMessage(`{}`), CreatedAt: time.UnixMilli(1000)}
+
+	// the first delivery times out on our side while the receiver keeps working
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- pub.Publish(ctx, e) }()
+	<-started
+	cancel()
+	if err := <-first; err == nil {
+		t.Fatal("expected the first delivery to fail")
+	}
+
+	err := pub.Publish(context.Background(), e)
+	if err == nil || IsPermanent(err) {
+		t.Fatalf("expected a retryable error while the first delivery is in flight, got %v", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		err = pub.Publish(context.Background(), e)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("expected redelivery to succeed once the first one completed, got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the receiver handler to run once, ran %d times", n)
+	}
+}
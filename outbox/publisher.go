@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mwdev22/rest/client"
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+type PublisherFunc func(ctx context.Context, e Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a publish error as not worth retrying, the event is marked
+// failed right away.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// MemoryPublisher delivers events to in-process subscribers and keeps what
+// was published, for tests and single-binary setups.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	subs   []func(ctx context.Context, e Event) error
+	events []Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Subscribe adds fn, called for every event in registration order. An error
+// fails the publish and the event is retried for all subscribers.
+func (p *MemoryPublisher) Subscribe(fn func(ctx context.Context, e Event) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs = append(p.subs, fn)
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, e Event) error {
+	p.mu.Lock()
+	subs := slices.Clone(p.subs)
+	p.mu.Unlock()
+
+	for _, fn := range subs {
+		if err := fn(ctx, e); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.events = append(p.events, e)
+	p.mu.Unlock()
+	return nil
+}
+
+// Events returns the published events in publish order.
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.events)
+}
+
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventTypeHeader = "X-Event-Type"
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+type WebhookOptions struct {
+	// Secret signs requests with HMAC-SHA256 over "<timestamp>.<body>" in
+	// SignatureHeader as "sha256=<hex>", unsigned when empty.
+	Secret string
+	Header http.Header
+	// Client defaults to one without retries, the worker retries instead.
+	Client *http.Client
+}
+
+// WebhookPublisher POSTs each event as JSON to a URL. 2xx is a success, 4xx
+// other than 408, 409 and 429 won't get better with retries and is permanent.
+// 409 is what the idempotency middleware answers while an earlier delivery of
+// the same event is still in flight, that one may yet succeed.
+type WebhookPublisher struct {
+	url  string
+	opts WebhookOptions
+}
+
+func NewWebhookPublisher(url string, opts WebhookOptions) *WebhookPublisher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Transport: client.Transport(client.Options{MaxRetries: 0, Timeout: 10 * time.Second})}
+	}
+	return &WebhookPublisher{url: url, opts: opts}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, v := range p.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	id := strconv.FormatInt(e.ID, 10)
+	req.Header.Set(EventIDHeader, id)
+	req.Header.Set(EventTypeHeader, e.Type)
+	// receivers using the idempotency middleware drop redeliveries
+	req.Header.Set("Idempotency-Key", "outbox-"+id)
+	if p.opts.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(p.opts.Secret, ts, body))
+	}
+
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	if err := client.CheckResponse(resp); err != nil {
+		var apiErr errs.ApiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 && !retryableStatus(apiErr.StatusCode) {
+			return Permanent(err)
+		}
+		return err
+	}
+	// drain so the keep-alive connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+	return nil
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// Sign computes the hex signature of a webhook body, for receivers to compare
+// with hmac.Equal.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
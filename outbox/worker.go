@@ -0,0 +1,260 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type WorkerOptions struct {
+	// PollInterval between polls when the last batch wasn't full, 1s by default.
+	PollInterval time.Duration
+	BatchSize    int
+	// Concurrency is how many aggregates publish at once, 4 by default. Events
+	// of one aggregate are always published one after another.
+	Concurrency int
+	// Timeout bounds a single Publish call, 10s by default.
+	Timeout time.Duration
+	// Lease is how long claimed events stay reserved for this worker. It is
+	// extended before each publish, so it only has to outlast one Timeout
+	// and is raised to at least 3 times that. An expired lease is picked up by
+	// another worker, 1 minute by default.
+	Lease time.Duration
+	// MaxAttempts marks an event failed after that many attempts so the rest
+	// of its aggregate can move on. 0 retries forever.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Retention of sent events before they are purged, 7 days by default.
+	// Negative keeps them.
+	Retention time.Duration
+}
+
+func DefaultWorkerOptions() WorkerOptions {
+	return WorkerOptions{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		Concurrency:  4,
+		Timeout:      10 * time.Second,
+		Lease:        time.Minute,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Minute,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Worker publishes pending events. Delivery is at least once: a crash
+// between Publish and marking the event sent, or an expired lease, publishes
+// it again, so consumers should dedupe by Event.ID.
+type Worker struct {
+	outbox    *Outbox
+	publisher Publisher
+	opts      WorkerOptions
+
+	once      sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+	lastPurge time.Time
+}
+
+// NewWorker builds a worker, zero fields of opts take DefaultWorkerOptions.
+func NewWorker(o *Outbox, p Publisher, opts WorkerOptions) *Worker {
+	def := DefaultWorkerOptions()
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = def.PollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = def.BatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = def.Concurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = def.Timeout
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = def.Lease
+	}
+	opts.Lease = max(opts.Lease, 3*opts.Timeout)
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = def.BaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = def.MaxDelay
+	}
+	if opts.Retention == 0 {
+		opts.Retention = def.Retention
+	}
+	return &Worker{
+		outbox:    o,
+		publisher: p,
+		opts:      opts,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Start runs the poll loop in the background until Shutdown.
+func (w *Worker) Start() {
+	go w.loop()
+}
+
+// Shutdown stops polling and waits for the batch in flight, fits
+// server.OnShutdown.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.once.Do(func() { close(w.done) })
+	select {
+	case <-w.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) loop() {
+	defer close(w.stopped)
+	// a batch in flight finishes and is marked even after Shutdown
+	ctx := context.Background()
+	for {
+		n, err := w.Poll(ctx)
+		if err != nil {
+			log.Printf("outbox: poll: %v", err)
+		}
+		w.purge(ctx)
+
+		wait := w.opts.PollInterval
+		if n == w.opts.BatchSize {
+			wait = 0
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Poll claims one batch and publishes it, returning how many events were
+// claimed.
+func (w *Worker) Poll(ctx context.Context) (int, error) {
+	events, err := w.outbox.claim(ctx, w.opts.BatchSize, w.opts.Lease)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	var groups [][]Event
+	index := map[string]int{}
+	for _, e := range events {
+		i, ok := index[e.Aggregate]
+		if !ok {
+			i = len(groups)
+			index[e.Aggregate] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], e)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, w.opts.Concurrency)
+	)
+	for _, group := range groups {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			if err := w.publishGroup(ctx, group); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return len(events), errors.Join(errs...)
+}
+
+// publishGroup publishes the events of one aggregate in order, stopping at
+// the first one to retry so later events wait for it. The lease is renewed
+// before each publish once half of it is used up, and a lost lease stops the
+// group so the worker that took it over is the only one publishing.
+func (w *Worker) publishGroup(ctx context.Context, group []Event) error {
+	lease := group[0].lease
+	for i, e := range group {
+		if time.Until(time.UnixMilli(lease)) < w.opts.Lease/2 {
+			next := time.Now().Add(w.opts.Lease).UnixMilli()
+			if err := w.outbox.renew(ctx, group[i:], lease, next); err != nil {
+				return fmt.Errorf("%s: %w", e.Aggregate, err)
+			}
+			lease = next
+		}
+		e.lease = lease
+
+		err := w.publish(ctx, e)
+		if err == nil {
+			if err := w.outbox.markSent(ctx, e); err != nil {
+				return fmt.Errorf("marking event %d sent: %w", e.ID, err)
+			}
+			continue
+		}
+
+		attempts := e.Attempts + 1
+		if IsPermanent(err) || (w.opts.MaxAttempts > 0 && attempts >= w.opts.MaxAttempts) {
+			log.Printf("outbox: giving up on event %d (%s %s) after %d attempts: %v", e.ID, e.Aggregate, e.Type, attempts, err)
+			if err := w.outbox.markFailed(ctx, e, err); err != nil {
+				return fmt.Errorf("marking event %d failed: %w", e.ID, err)
+			}
+			continue
+		}
+
+		log.Printf("outbox: publishing event %d (%s %s) failed, attempt %d: %v", e.ID, e.Aggregate, e.Type, attempts, err)
+		if err := w.outbox.markRetry(ctx, e, time.Now().Add(w.backoff(e.Attempts)), err); err != nil {
+			return fmt.Errorf("marking event %d for retry: %w", e.ID, err)
+		}
+		var errs []error
+		for _, rest := range group[i+1:] {
+			rest.lease = lease
+			errs = append(errs, w.outbox.release(ctx, rest))
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (w *Worker) publish(ctx context.Context, e Event) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("publisher panic: %v", p)
+		}
+	}()
+	return w.publisher.Publish(ctx, e)
+}
+
+// backoff is exponential with full jitter.
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.opts.BaseDelay << attempt
+	if d <= 0 || d > w.opts.MaxDelay {
+		d = w.opts.MaxDelay
+	}
+	return rand.N(d)
+}
+
+func (w *Worker) purge(ctx context.Context) {
+	if w.opts.Retention < 0 || time.Since(w.lastPurge) < time.Hour {
+		return
+	}
+	w.lastPurge = time.Now()
+	n, err := w.outbox.Purge(ctx, time.Now().Add(-w.opts.Retention))
+	if err != nil {
+		log.Printf("outbox: purge: %v", err)
+	} else if n > 0 {
+		log.Printf("outbox: purged %d sent events", n)
+	}
+}
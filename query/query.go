@@ -0,0 +1,223 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+type Operator string
+
+const (
+	Eq       Operator = "eq"
+	Ne       Operator = "ne"
+	Gt       Operator = "gt"
+	Gte      Operator = "gte"
+	Lt       Operator = "lt"
+	Lte      Operator = "lte"
+	In       Operator = "in"
+	Contains Operator = "contains"
+	IsNull   Operator = "null"
+)
+
+var (
+	Equality   = []Operator{Eq, Ne, In}
+	Comparison = []Operator{Eq, Ne, Gt, Gte, Lt, Lte, In}
+)
+
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time
+)
+
+type Field struct {
+	// Name is the name used in the query string.
+	Name string
+	// Column is the SQL expression emitted for the field, defaults to Name.
+	// It comes from code, never from the request.
+	Column   string
+	Type     Type
+	Ops      []Operator
+	Sortable bool
+}
+
+type Schema struct {
+	fields      map[string]Field
+	defaultSort []SortField
+}
+
+func NewSchema(fields ...Field) Schema {
+	s := Schema{fields: make(map[string]Field, len(fields))}
+	for _, f := range fields {
+		if f.Column == "" {
+			f.Column = f.Name
+		}
+		s.fields[f.Name] = f
+	}
+	return s
+}
+
+// WithDefaultSort is used when the request has no sort param, e.g. "-created_at,id".
+func (s Schema) WithDefaultSort(spec string) Schema {
+	sorts, err := s.parseSort(spec)
+	if err != nil {
+		panic(fmt.Sprintf("query: invalid default sort %q", spec))
+	}
+	s.defaultSort = sorts
+	return s
+}
+
+type Condition struct {
+	Field  string
+	Column string
+	Op     Operator
+	// Value holds the typed value, for In it is a []any.
+	Value any
+}
+
+type SortField struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+type Query struct {
+	Filters []Condition
+	Sort    []SortField
+}
+
+// Parse reads filter[field]=v, filter[field][op]=v and sort=-a,b params,
+// anything outside the schema is rejected with errs.InvalidQueryParam.
+func (s Schema) Parse(values url.Values) (Query, error) {
+	var q Query
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if strings.HasPrefix(k, "filter[") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(values[key]) != 1 {
+			return Query{}, errs.InvalidQueryParam(key)
+		}
+		cond, err := s.parseFilter(key, values[key][0])
+		if err != nil {
+			return Query{}, errs.InvalidQueryParam(key)
+		}
+		q.Filters = append(q.Filters, cond)
+	}
+
+	q.Sort = s.defaultSort
+	if spec := values.Get("sort"); spec != "" {
+		sorts, err := s.parseSort(spec)
+		if err != nil {
+			return Query{}, errs.InvalidQueryParam("sort")
+		}
+		q.Sort = sorts
+	}
+	return q, nil
+}
+
+func (s Schema) parseFilter(key, raw string) (Condition, error) {
+	name, op, err := splitFilterKey(key)
+	if err != nil {
+		return Condition{}, err
+	}
+
+	f, ok := s.fields[name]
+	if !ok {
+		return Condition{}, fmt.Errorf("unknown field %s", name)
+	}
+	if !slices.Contains(f.Ops, op) {
+		return Condition{}, fmt.Errorf("operator %s not allowed on %s", op, name)
+	}
+
+	cond := Condition{Field: name, Column: f.Column, Op: op}
+	switch op {
+	case IsNull:
+		cond.Value, err = strconv.ParseBool(raw)
+	case In:
+		parts := strings.Split(raw, ",")
+		list := make([]any, len(parts))
+		for i, p := range parts {
+			if list[i], err = parseValue(f.Type, p); err != nil {
+				return Condition{}, err
+			}
+		}
+		cond.Value = list
+	case Contains:
+		if f.Type != String {
+			return Condition{}, fmt.Errorf("contains requires a string field")
+		}
+		cond.Value = raw
+	default:
+		cond.Value, err = parseValue(f.Type, raw)
+	}
+	return cond, err
+}
+
+// splitFilterKey turns filter[name] and filter[name][op] into its parts.
+func splitFilterKey(key string) (string, Operator, error) {
+	rest := strings.TrimPrefix(key, "filter[")
+	name, rest, ok := strings.Cut(rest, "]")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("malformed filter %s", key)
+	}
+	if rest == "" {
+		return name, Eq, nil
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") || len(rest) < 3 {
+		return "", "", fmt.Errorf("malformed filter %s", key)
+	}
+	return name, Operator(rest[1 : len(rest)-1]), nil
+}
+
+func (s Schema) parseSort(spec string) ([]SortField, error) {
+	var sorts []SortField
+	seen := map[string]bool{}
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.TrimSpace(token)
+		desc := strings.HasPrefix(token, "-")
+		name := strings.TrimLeft(token, "+-")
+
+		f, ok := s.fields[name]
+		if !ok || !f.Sortable || seen[name] {
+			return nil, fmt.Errorf("cannot sort by %q", token)
+		}
+		seen[name] = true
+		sorts = append(sorts, SortField{Field: name, Column: f.Column, Desc: desc})
+	}
+	return sorts, nil
+}
+
+func parseValue(t Type, raw string) (any, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(raw, 10, 64)
+	case Float:
+		return strconv.ParseFloat(raw, 64)
+	case Bool:
+		return strconv.ParseBool(raw)
+	case Time:
+		if v, err := time.Parse(time.RFC3339, raw); err == nil {
+			return v, nil
+		}
+		return time.Parse(time.DateOnly, raw)
+	default:
+		return raw, nil
+	}
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/utils/errs"
+)
+
+var orders = NewSchema(
+	Field{Name: "status", Ops: []Operator{Eq, Ne, In}},
+	Field{Name: "created_at", Column: "o.created_at", Type: Time, Ops: Comparison, Sortable: true},
+	Field{Name: "total", Type: Float, Ops: Comparison, Sortable: true},
+	Field{Name: "name", Ops: []Operator{Eq, Contains}, Sortable: true},
+	Field{Name: "deleted_at", Type: Time, Ops: []Operator{IsNull}},
+).WithDefaultSort("-created_at")
+
+func TestParseAndTranslate(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		ph            Placeholder
+		argOffset     int
+		expectedWhere string
+		expectedArgs  []any
+		expectedOrder string
+	}{
+		{
+			name:          "equality and range with sort",
+			query:         "filter[status]=active&filter[created_at][gte]=2026-01-01&sort=-created_at,name",
+			ph:            Dollar,
+			expectedWhere: "o.created_at >= $1 AND status = $2",
+			expectedArgs:  []any{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "active"},
+			expectedOrder: "o.created_at DESC, name ASC",
+		},
+		{
+			name:          "in list continues after offset",
+			query:         "filter[status][in]=new,paid",
+			ph:            Dollar,
+			argOffset:     2,
+			expectedWhere: "status IN ($3, $4)",
+			expectedArgs:  []any{"new", "paid"},
+			expectedOrder: "o.created_at DESC",
+		},
+		{
+			name:          "contains escapes like wildcards",
+			query:         "filter[name][contains]=50%25_off&sort=name",
+			ph:            Question,
+			expectedWhere: "name LIKE ? ESCAPE '!'",
+			expectedArgs:  []any{"%50!%!_off%"},
+			expectedOrder: "name ASC",
+		},
+		{
+			name:          "null check and typed number",
+			query:         "filter[deleted_at][null]=true&filter[total][lt]=9.5",
+			ph:            Question,
+			expectedWhere: "deleted_at IS NULL AND total < ?",
+			expectedArgs:  []any{9.5},
+			expectedOrder: "o.created_at DESC",
+		},
+		{
+			name:          "no filters",
+			query:         "page=2",
+			ph:            Question,
+			expectedOrder: "o.created_at DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := orders.Parse(values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			where, args := q.Where(tt.ph, tt.argOffset)
+			if where != tt.expectedWhere {
+				t.Errorf("expected where %q, got %q", tt.expectedWhere, where)
+			}
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("expected args %v, got %v", tt.expectedArgs, args)
+			}
+			if order := q.OrderBy(); order != tt.expectedOrder {
+				t.Errorf("expected order %q, got %q", tt.expectedOrder, order)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{
+			name:          "unknown field",
+			query:         "filter[password]=x",
+			expectedError: "invalid query param: filter[password]",
+		},
+		{
+			name:          "operator not allowed",
+			query:         "filter[status][gt]=a",
+			expectedError: "invalid query param: filter[status][gt]",
+		},
+		{
+			name:          "unknown operator",
+			query:         "filter[total][between]=1",
+			expectedError: "invalid query param: filter[total][between]",
+		},
+		{
+			name:          "bad typed value",
+			query:         "filter[created_at][gte]=yesterday",
+			expectedError: "invalid query param: filter[created_at][gte]",
+		},
+		{
+			name:          "malformed key",
+			query:         "filter[status",
+			expectedError: "invalid query param: filter[status",
+		},
+		{
+			name:          "injection attempt in field name",
+			query:         "filter[status)+OR+1%3D1+--]=x",
+			expectedError: "invalid query param: filter[status) OR 1=1 --]",
+		},
+		{
+			name:          "repeated filter",
+			query:         "filter[status]=a&filter[status]=b",
+			expectedError: "invalid query param: filter[status]",
+		},
+		{
+			name:          "not sortable",
+			query:         "sort=status",
+			expectedError: "invalid query param: sort",
+		},
+		{
+			name:          "duplicate sort",
+			query:         "sort=name,-name",
+			expectedError: "invalid query param: sort",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			_, err := orders.Parse(values)
+
+			var e errs.ApiError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected ApiError, got %v", err)
+			}
+			if e.Msg != tt.expectedError {
+				t.Errorf("expected %q, got %q", tt.expectedError, e.Msg)
+			}
+		})
+	}
+}
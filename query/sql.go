@@ -0,0 +1,79 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Placeholder func(n int) string
+
+var (
+	// Question renders ? placeholders (MySQL, SQLite).
+	Question Placeholder = func(int) string { return "?" }
+	// Dollar renders $1, $2... placeholders (PostgreSQL).
+	Dollar Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+var sqlOperators = map[Operator]string{
+	Eq:  "=",
+	Ne:  "<>",
+	Gt:  ">",
+	Gte: ">=",
+	Lt:  "<",
+	Lte: "<=",
+}
+
+// likeEscaper escapes with '!' rather than a backslash, which MySQL would
+// read as an escape inside the ESCAPE '\' literal itself.
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+// Where renders the filters joined with AND, without the WHERE keyword.
+// Values are always passed as args, argOffset is the number of args already
+// used by the surrounding statement so $n placeholders continue after them.
+func (q Query) Where(ph Placeholder, argOffset int) (string, []any) {
+	var (
+		parts []string
+		args  []any
+	)
+	next := func(v any) string {
+		args = append(args, v)
+		return ph(argOffset + len(args))
+	}
+
+	for _, c := range q.Filters {
+		switch c.Op {
+		case IsNull:
+			if c.Value.(bool) {
+				parts = append(parts, c.Column+" IS NULL")
+			} else {
+				parts = append(parts, c.Column+" IS NOT NULL")
+			}
+		case In:
+			values := c.Value.([]any)
+			marks := make([]string, len(values))
+			for i, v := range values {
+				marks[i] = next(v)
+			}
+			parts = append(parts, c.Column+" IN ("+strings.Join(marks, ", ")+")")
+		case Contains:
+			pattern := "%" + likeEscaper.Replace(c.Value.(string)) + "%"
+			parts = append(parts, c.Column+" LIKE "+next(pattern)+" ESCAPE '!'")
+		default:
+			parts = append(parts, c.Column+" "+sqlOperators[c.Op]+" "+next(c.Value))
+		}
+	}
+	return strings.Join(parts, " AND "), args
+}
+
+// OrderBy renders the sort fields without the ORDER BY keyword.
+func (q Query) OrderBy() string {
+	parts := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		parts[i] = s.Column + " " + dir
+	}
+	return strings.Join(parts, ", ")
+}
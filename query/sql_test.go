@@ -0,0 +1,70 @@
+package query
+
+import (
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestWhereOnSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, name TEXT, status TEXT, total REAL, created_at TEXT, deleted_at TEXT);
+		INSERT INTO orders (id, name, status, total) VALUES
+			(1, '50% off', 'new', 5),
+			(2, '500 off', 'new', 10),
+			(3, 'a_b', 'paid', 15),
+			(4, 'axb', 'paid', 20),
+			(5, 'wow!', 'paid', 25),
+			(6, 'back\slash', 'new', 30);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		expectedIDs []int
+	}{
+		{name: "percent is literal", query: "filter[name][contains]=0%25", expectedIDs: []int{1}},
+		{name: "underscore is literal", query: "filter[name][contains]=a_", expectedIDs: []int{3}},
+		{name: "escape character is literal", query: "filter[name][contains]=w!", expectedIDs: []int{5}},
+		{name: "backslash is literal", query: `filter[name][contains]=k\s`, expectedIDs: []int{6}},
+		{name: "combined", query: "filter[status][in]=new,paid&filter[total][gte]=10&filter[name][contains]=off", expectedIDs: []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := orders.Parse(values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			where, args := q.Where(Question, 0)
+
+			rows, err := db.Query("SELECT id FROM orders WHERE "+where+" ORDER BY id", args...)
+			if err != nil {
+				t.Fatalf("query %q failed: %v", where, err)
+			}
+			defer rows.Close()
+			var ids []int
+			for rows.Next() {
+				var id int
+				rows.Scan(&id)
+				ids = append(ids, id)
+			}
+			if !reflect.DeepEqual(ids, tt.expectedIDs) {
+				t.Errorf("expected ids %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/resp/resptest"
+)
+
+func TestClient(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.Addr, Options{Password: "secret", DB: 1, PoolSize: 2})
+	defer c.Close()
+	ctx := context.Background()
+
+	if reply, err := c.Do(ctx, "SET", "k", []byte("v\r\nwith newline"), "PX", 1000); err != nil || reply != "OK" {
+		t.Fatalf("expected OK, got %v %v", reply, err)
+	}
+	b, err := Bytes(c.Do(ctx, "GET", "k"))
+	if err != nil || string(b) != "v\r\nwith newline" {
+		t.Errorf("expected stored value, got %q %v", b, err)
+	}
+	if b, err := Bytes(c.Do(ctx, "GET", "missing")); err != nil || b != nil {
+		t.Errorf("expected nil for a missing key, got %q %v", b, err)
+	}
+	if n, err := Int(c.Do(ctx, "SADD", "s", "a", "b", "a")); err != nil || n != 2 {
+		t.Errorf("expected 2 members added, got %d %v", n, err)
+	}
+	if members, err := Strings(c.Do(ctx, "SMEMBERS", "s")); err != nil || len(members) != 2 {
+		t.Errorf("expected 2 members, got %v %v", members, err)
+	}
+
+	_, err = c.Do(ctx, "GET", "s")
+	var replyErr Error
+	if !errors.As(err, &replyErr) {
+		t.Errorf("expected error reply, got %v", err)
+	}
+	// an error reply leaves the connection usable
+	if reply, err := c.Do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected PONG, got %v %v", reply, err)
+	}
+
+	srv.Advance(2 * time.Second)
+	if b, _ := Bytes(c.Do(ctx, "GET", "k")); b != nil {
+		t.Errorf("expected key to expire, got %q", b)
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	srv := resptest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.Addr, Options{})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Do(ctx, "PING"); err == nil {
+		t.Error("expected error for canceled context")
+	}
+	if reply, err := c.Do(context.Background(), "PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected PONG after cancellation, got %v %v", reply, err)
+	}
+}
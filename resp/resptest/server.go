@@ -0,0 +1,317 @@
+// Package resptest runs an in-process server speaking the Redis protocol for
+// tests, with the handful of commands the stores in this module use.
+package resptest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	Addr string
+
+	ln     net.Listener
+	closed chan struct{}
+	mu     sync.Mutex
+	now    time.Time
+	values map[string]*value
+	wg     sync.WaitGroup
+}
+
+type value struct {
+	str     []byte
+	set     map[string]struct{}
+	expires time.Time
+}
+
+// NewServer listens on a random local port, stop it with Close.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("resptest: failed to listen: %v", err))
+	}
+	s := &Server{Addr: ln.Addr().String(), ln: ln, closed: make(chan struct{}), now: time.Now(), values: map[string]*value{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Advance moves the server clock forward to expire keys without sleeping.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	s.now = s.now.Add(d)
+	s.mu.Unlock()
+}
+
+// Keys returns the number of live keys.
+func (s *Server) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k := range s.values {
+		if s.lookup(k) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) Close() {
+	close(s.closed)
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.handle(c)
+		}()
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// unblock the reader once the server is closed
+		select {
+		case <-s.closed:
+			c.Close()
+		case <-done:
+		}
+	}()
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.exec(args)
+		s.mu.Unlock()
+		writeReply(w, reply)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+type errReply string
+
+func (s *Server) lookup(key string) *value {
+	v, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	if !v.expires.IsZero() && !s.now.Before(v.expires) {
+		delete(s.values, key)
+		return nil
+	}
+	return v
+}
+
+func (s *Server) exec(args []string) (reply any) {
+	defer func() {
+		// out of range args, let the client see an error instead of crashing
+		if recover() != nil {
+			reply = errReply("ERR wrong number of arguments")
+		}
+	}()
+	if len(args) == 0 {
+		return errReply("ERR empty command")
+	}
+	cmd, args := strings.ToUpper(args[0]), args[1:]
+	switch cmd {
+	case "PING":
+		return "PONG"
+	case "AUTH", "SELECT":
+		return "OK"
+	case "FLUSHALL", "FLUSHDB":
+		s.values = map[string]*value{}
+		return "OK"
+	case "GET":
+		v := s.lookup(args[0])
+		if v == nil {
+			return nil
+		}
+		if v.set != nil {
+			return errReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		return v.str
+	case "SET":
+		key, val := args[0], args[1]
+		v := &value{str: []byte(val)}
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if s.lookup(key) != nil {
+					return nil
+				}
+			case "XX":
+				if s.lookup(key) == nil {
+					return nil
+				}
+			case "EX", "PX":
+				i++
+				n, _ := strconv.ParseInt(args[i], 10, 64)
+				unit := time.Millisecond
+				if strings.ToUpper(args[i-1]) == "EX" {
+					unit = time.Second
+				}
+				v.expires = s.now.Add(time.Duration(n) * unit)
+			}
+		}
+		s.values[key] = v
+		return "OK"
+	case "DEL", "UNLINK", "EXISTS":
+		n := int64(0)
+		for _, key := range args {
+			if s.lookup(key) != nil {
+				n++
+				if cmd != "EXISTS" {
+					delete(s.values, key)
+				}
+			}
+		}
+		return n
+	case "INCR":
+		v := s.lookup(args[0])
+		if v == nil {
+			v = &value{str: []byte("0")}
+			s.values[args[0]] = v
+		}
+		n, err := strconv.ParseInt(string(v.str), 10, 64)
+		if err != nil {
+			return errReply("ERR value is not an integer or out of range")
+		}
+		n++
+		v.str = strconv.AppendInt(nil, n, 10)
+		return n
+	case "PEXPIRE", "EXPIRE":
+		v := s.lookup(args[0])
+		if v == nil {
+			return int64(0)
+		}
+		n, _ := strconv.ParseInt(args[1], 10, 64)
+		unit := time.Millisecond
+		if cmd == "EXPIRE" {
+			unit = time.Second
+		}
+		v.expires = s.now.Add(time.Duration(n) * unit)
+		return int64(1)
+	case "PTTL":
+		v := s.lookup(args[0])
+		switch {
+		case v == nil:
+			return int64(-2)
+		case v.expires.IsZero():
+			return int64(-1)
+		}
+		return v.expires.Sub(s.now).Milliseconds()
+	case "SADD":
+		v := s.lookup(args[0])
+		if v == nil {
+			v = &value{set: map[string]struct{}{}}
+			s.values[args[0]] = v
+		}
+		n := int64(0)
+		for _, m := range args[1:] {
+			if _, ok := v.set[m]; !ok {
+				v.set[m] = struct{}{}
+				n++
+			}
+		}
+		return n
+	case "SREM":
+		v := s.lookup(args[0])
+		n := int64(0)
+		if v != nil {
+			for _, m := range args[1:] {
+				if _, ok := v.set[m]; ok {
+					delete(v.set, m)
+					n++
+				}
+			}
+		}
+		return n
+	case "SMEMBERS":
+		v := s.lookup(args[0])
+		members := []any{}
+		if v != nil {
+			for m := range v.set {
+				members = append(members, []byte(m))
+			}
+		}
+		return members
+	}
+	return errReply(fmt.Sprintf("ERR unknown command '%s'", cmd))
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		// inline command, as typed into telnet
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case errReply:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds draining in-flight requests and running the shutdown hooks.
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long readiness reports failing before the listener
+	// closes, so load balancers stop routing new requests first.
+	DrainDelay time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		DrainDelay:        5 * time.Second,
+	}
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type Server struct {
+	cfg     Config
+	http    *http.Server
+	ready   atomic.Bool
+	started atomic.Bool
+
+	mu         sync.Mutex
+	hooks      []hook
+	startHooks []hook
+}
+
+func New(handler http.Handler, cfg Config) *Server {
+	return &Server{
+		cfg: cfg,
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+	}
+}
+
+// OnStart registers a hook run in registration order once the listener is up
+// and before readiness turns green, e.g. migrations. Liveness probes are
+// answered meanwhile, a failing hook shuts the server down.
+func (s *Server) OnStart(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startHooks = append(s.startHooks, hook{name: name, fn: fn})
+}
+
+// OnShutdown registers a hook run after the HTTP server drained, hooks run in
+// reverse registration order so dependencies opened first are closed last.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook{name: name, fn: fn})
+}
+
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+func (s *Server) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.started.Load() {
+		jsonutil.Write(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+		return
+	}
+	if !s.Ready() {
+		jsonutil.Write(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+		return
+	}
+	jsonutil.Write(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Run listens on Config.Addr until ctx is cancelled or SIGINT/SIGTERM arrives,
+// then shuts down gracefully. A second signal during shutdown kills the
+// process.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// restore the default handlers so the next signal force-exits
+		stop()
+	}()
+	return s.Serve(ctx, ln)
+}
+
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("server listening on %s", ln.Addr())
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	err := s.runStartHooks(ctx)
+	if err == nil && ctx.Err() == nil {
+		s.started.Store(true)
+		s.ready.Store(true)
+	} else if err != nil {
+		// nothing was routed here yet, so close without draining
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+		defer cancel()
+		s.http.Shutdown(shutdownCtx)
+		<-serveErr
+		return errors.Join(err, s.runHooks(shutdownCtx))
+	}
+
+	select {
+	case err = <-serveErr:
+		// the listener died on its own, still release what was opened
+		s.ready.Store(false)
+		return errors.Join(err, s.runHooks(context.Background()))
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, draining for %s", s.cfg.DrainDelay)
+	s.ready.Store(false)
+	time.Sleep(s.cfg.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+
+	if err = s.http.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if serr := <-serveErr; !errors.Is(serr, http.ErrServerClosed) {
+		err = errors.Join(err, serr)
+	}
+	return errors.Join(err, s.runHooks(shutdownCtx))
+}
+
+func (s *Server) runStartHooks(ctx context.Context) error {
+	s.mu.Lock()
+	hooks := append([]hook(nil), s.startHooks...)
+	s.mu.Unlock()
+
+	for _, h := range hooks {
+		if ctx.Err() != nil {
+			return nil
+		}
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			err = fmt.Errorf("start hook %s: %w", h.name, err)
+			log.Print(err)
+			return err
+		}
+		log.Printf("start hook %s done in %s", h.name, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (s *Server) runHooks(ctx context.Context) error {
+	s.mu.Lock()
+	hooks := append([]hook(nil), s.hooks...)
+	s.mu.Unlock()
+
+	var failed []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if err := h.fn(ctx); err != nil {
+			err = fmt.Errorf("shutdown hook %s: %w", h.name, err)
+			log.Print(err)
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.cfg.ShutdownTimeout <= 0 {
+		return DefaultConfig().ShutdownTimeout
+	}
+	return s.cfg.ShutdownTimeout
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	cfg := DefaultConfig()
+	cfg.DrainDelay = 50 * time.Millisecond
+	cfg.ShutdownTimeout = 2 * time.Second
+	srv := New(mux, cfg)
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	for _, name := range []string{"db", "cache", "workers"} {
+		srv.OnShutdown(name, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			if name == "cache" {
+				return errors.New("cache close failed")
+			}
+			return nil
+		})
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	if !srv.Ready() {
+		t.Fatal("expected server to be ready while serving")
+	}
+	cancel()
+
+	// readiness flips before the in-flight request is released
+	time.Sleep(10 * time.Millisecond)
+	if srv.Ready() {
+		t.Error("expected readiness to fail while draining")
+	}
+	w := httptest.NewRecorder()
+	srv.ReadinessHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 from readiness handler, got %d", w.Code)
+	}
+
+	close(release)
+	if got := <-body; got != "done" {
+		t.Errorf("expected in-flight request to complete, got %q", got)
+	}
+
+	err = <-done
+	if err == nil || err.Error() != "shutdown hook cache: cache close failed" {
+		t.Errorf("expected hook error to be returned, got %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"workers", "cache", "db"}) {
+		t.Errorf("expected hooks in reverse order, got %v", order)
+	}
+}
+
+func TestStartHooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		hookErr       error
+		expectedReady bool
+	}{
+		{name: "ready after hooks", expectedReady: true},
+		{name: "failing hook stops server", hookErr: errors.New("migration failed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.DrainDelay = 0
+			srv := New(http.NewServeMux(), cfg)
+
+			release := make(chan struct{})
+			running := make(chan struct{})
+			srv.OnStart("migrations", func(ctx context.Context) error {
+				close(running)
+				<-release
+				return tt.hookErr
+			})
+			closed := false
+			srv.OnShutdown("db", func(ctx context.Context) error {
+				closed = true
+				return nil
+			})
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- srv.Serve(ctx, ln) }()
+
+			<-running
+			w := httptest.NewRecorder()
+			srv.ReadinessHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "starting") {
+				t.Errorf("expected 503 starting while hooks run, got %d %s", w.Code, w.Body.String())
+			}
+			close(release)
+
+			if tt.hookErr != nil {
+				err := <-done
+				if !errors.Is(err, tt.hookErr) {
+					t.Errorf("expected hook error, got %v", err)
+				}
+				if !closed {
+					t.Error("expected shutdown hooks to run after a failed start")
+				}
+				return
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for !srv.Ready() && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if !srv.Ready() {
+				t.Error("expected server to be ready after start hooks")
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("expected clean shutdown, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package sse
+
+import (
+	"strconv"
+	"sync"
+)
+
+type ReplayBuffer interface {
+	// Append stores the event, assigning an ID when it has none, and returns the stored event.
+	Append(e Event) Event
+	// Since returns events recorded after lastID, or every retained event when
+	// lastID has already been evicted.
+	Since(lastID string) ([]Event, error)
+}
+
+type MemoryReplay struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+	seq    uint64
+}
+
+const defaultReplaySize = 100
+
+func NewMemoryReplay(size int) *MemoryReplay {
+	if size <= 0 {
+		size = defaultReplaySize
+	}
+	return &MemoryReplay{
+		events: make([]Event, 0, size),
+		size:   size,
+	}
+}
+
+func (m *MemoryReplay) Append(e Event) Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(m.seq, 10)
+	}
+	if len(m.events) == m.size {
+		copy(m.events, m.events[1:])
+		m.events = m.events[:len(m.events)-1]
+	}
+	m.events = append(m.events, e)
+	return e
+}
+
+func (m *MemoryReplay) Since(lastID string) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, e := range m.events {
+		if e.ID == lastID {
+			return append([]Event(nil), m.events[i+1:]...), nil
+		}
+	}
+	return append([]Event(nil), m.events...), nil
+}
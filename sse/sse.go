@@ -0,0 +1,205 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrFlushNotSupported = errors.New("sse: response writer does not support flushing")
+
+type Event struct {
+	ID    string
+	Event string
+	Retry time.Duration
+	// Data is written as-is when it is a string or []byte and JSON encoded otherwise.
+	Data any
+}
+
+type Options struct {
+	// Heartbeat sends a comment line on idle connections so proxies keep them open, 0 disables it.
+	Heartbeat time.Duration
+	// Retry is sent once on connect as the client reconnection delay.
+	Retry time.Duration
+	// Replay, when set, is used to resend events after the client's Last-Event-ID.
+	Replay ReplayBuffer
+}
+
+type Stream struct {
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	ctx  context.Context
+	mu   sync.Mutex
+	err  error
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func NewStream(w http.ResponseWriter, r *http.Request, opts Options) (*Stream, error) {
+	rc := http.NewResponseController(w)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return nil, ErrFlushNotSupported
+	}
+	// long lived connection, the server wide write timeout must not cut it
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	s := &Stream{
+		w:    w,
+		rc:   rc,
+		ctx:  r.Context(),
+		stop: make(chan struct{}),
+	}
+
+	if opts.Retry > 0 {
+		if err := s.write(fmt.Sprintf("retry: %d\n\n", opts.Retry.Milliseconds())); err != nil {
+			return nil, err
+		}
+	}
+
+	if lastID := LastEventID(r); lastID != "" && opts.Replay != nil {
+		missed, err := opts.Replay.Since(lastID)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range missed {
+			if err := s.Send(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if opts.Heartbeat > 0 {
+		s.wg.Add(1)
+		go s.heartbeat(opts.Heartbeat)
+	}
+	return s, nil
+}
+
+func LastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	// EventSource polyfills that cannot set headers pass it in the query
+	return r.URL.Query().Get("lastEventId")
+}
+
+func (s *Stream) Send(e Event) error {
+	data, err := encodeData(e.Data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + sanitize(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + sanitize(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+func (s *Stream) SendJSON(event string, v any) error {
+	return s.Send(Event{Event: event, Data: v})
+}
+
+func (s *Stream) Comment(text string) error {
+	return s.write(": " + sanitize(text) + "\n\n")
+}
+
+// Done is closed when the client goes away.
+func (s *Stream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close stops the heartbeat, it has to be called before the handler returns.
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+}
+
+func (s *Stream) heartbeat(interval time.Duration) {
+	defer s.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Comment("ping"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Stream) write(chunk string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+	if _, err := s.w.Write([]byte(chunk)); err != nil {
+		s.err = err
+		return err
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.err = err
+		return err
+	}
+	return nil
+}
+
+func encodeData(v any) (string, error) {
+	switch d := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return d, nil
+	case []byte:
+		return string(d), nil
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
+
+// field values other than data must not contain line breaks, they would end the field
+func sanitize(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
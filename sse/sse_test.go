@@ -0,0 +1,155 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwdev22/rest/middleware"
+)
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{
+			name:     "data only",
+			event:    Event{Data: "hello"},
+			expected: "data: hello\n\n",
+		},
+		{
+			name:     "all fields",
+			event:    Event{ID: "7", Event: "update", Retry: 3 * time.Second, Data: "x"},
+			expected: "id: 7\nevent: update\nretry: 3000\ndata: x\n\n",
+		},
+		{
+			name:     "multiline data",
+			event:    Event{Data: "a\nb"},
+			expected: "data: a\ndata: b\n\n",
+		},
+		{
+			name:     "json data",
+			event:    Event{Event: "tick", Data: map[string]int{"n": 1}},
+			expected: "event: tick\ndata: {\"n\":1}\n\n",
+		},
+		{
+			name:     "newline in id is stripped",
+			event:    Event{ID: "1\ndata: injected", Data: "x"},
+			expected: "id: 1data: injected\ndata: x\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			w := httptest.NewRecorder()
+
+			s, err := NewStream(w, req, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer s.Close()
+
+			if err := s.Send(tt.event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.Body.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("expected text/event-stream, got %s", ct)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	replay := NewMemoryReplay(3)
+	for _, d := range []string{"a", "b", "c", "d"} {
+		replay.Append(Event{Data: d})
+	}
+
+	tests := []struct {
+		name     string
+		lastID   string
+		expected string
+	}{
+		{
+			name:     "resume after known id",
+			lastID:   "3",
+			expected: "id: 4\ndata: d\n\n",
+		},
+		{
+			name:     "evicted id replays everything retained",
+			lastID:   "1",
+			expected: "id: 2\ndata: b\n\nid: 3\ndata: c\n\nid: 4\ndata: d\n\n",
+		},
+		{
+			name:     "no last id",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if tt.lastID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastID)
+			}
+			w := httptest.NewRecorder()
+
+			s, err := NewStream(w, req, Options{Replay: replay})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s.Close()
+
+			if w.Body.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamThroughLogger(t *testing.T) {
+	sent := make(chan struct{})
+	srv := httptest.NewServer(middleware.Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := NewStream(w, r, Options{Heartbeat: 10 * time.Millisecond})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		defer s.Close()
+
+		s.Send(Event{ID: "1", Data: "first"})
+		close(sent)
+		<-s.Done()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// the event must arrive while the handler is still blocked, i.e. it was flushed
+	<-sent
+	br := bufio.NewReader(resp.Body)
+	var got strings.Builder
+	for !strings.Contains(got.String(), ": ping\n\n") {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v (got %q)", err, got.String())
+		}
+		got.WriteString(line)
+	}
+	if !strings.HasPrefix(got.String(), "id: 1\ndata: first\n\n") {
+		t.Errorf("unexpected stream start: %q", got.String())
+	}
+}
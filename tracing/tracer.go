@@ -0,0 +1,264 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mwdev22/rest/cctx"
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultQueueSize     = 2048
+)
+
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota + 1
+	KindServer
+	KindClient
+)
+
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Err          string
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = map[string]any{}
+	}
+	s.Attributes[key] = value
+}
+
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Name = name
+}
+
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err.Error()
+}
+
+// Finish ends the span and queues it for export when sampled, later calls are no-ops.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.SpanContext.Sampled() && s.tracer != nil {
+		s.tracer.enqueue(s)
+	}
+}
+
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Sampler decides for new root traces, child spans follow the parent's sampled flag.
+type Sampler func(id TraceID) bool
+
+func AlwaysSample(TraceID) bool { return true }
+
+func RatioSampler(ratio float64) Sampler {
+	bound := uint64(ratio * (1 << 63))
+	return func(id TraceID) bool {
+		// the low 8 bytes are random, compare them like the OpenTelemetry ratio sampler
+		return binary.BigEndian.Uint64(id[8:])>>1 < bound
+	}
+}
+
+type Config struct {
+	Exporter      Exporter
+	Sampler       Sampler
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+type Tracer struct {
+	cfg   Config
+	queue chan *Span
+	flush chan chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewTracer(cfg Config) *Tracer {
+	if cfg.Sampler == nil {
+		cfg.Sampler = AlwaysSample
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	t := &Tracer{
+		cfg:   cfg,
+		queue: make(chan *Span, defaultQueueSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Start creates a span, child of the span in ctx (or of a remote parent set by
+// ContextWithRemoteParent), and returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		tracer: t,
+	}
+
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		span.SpanContext = SpanContext{
+			TraceID:    parent.TraceID,
+			SpanID:     newSpanID(),
+			Flags:      parent.Flags,
+			TraceState: parent.TraceState,
+		}
+		span.ParentSpanID = parent.SpanID
+	} else {
+		id := newTraceID()
+		span.SpanContext = SpanContext{TraceID: id, SpanID: newSpanID()}
+		if t.cfg.Sampler(id) {
+			span.SpanContext.Flags |= flagSampled
+		}
+	}
+
+	ctx = context.WithValue(ctx, cctx.SpanKey, span)
+	ctx = context.WithValue(ctx, cctx.TraceIDKey, span.SpanContext.TraceID.String())
+	return ctx, span
+}
+
+// Flush exports everything queued so far.
+func (t *Tracer) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case t.flush <- ack:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown flushes pending spans and stops the export loop, fits server.OnShutdown.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	err := t.Flush(ctx)
+	t.once.Do(func() { close(t.done) })
+	return err
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		// never block request handling on a slow exporter
+		log.Printf("tracing: export queue full, dropping span %s", s.Name)
+	}
+}
+
+func (t *Tracer) loop() {
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.cfg.BatchSize)
+	export := func() {
+		if len(batch) == 0 || t.cfg.Exporter == nil {
+			batch = batch[:0]
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.cfg.Exporter.Export(ctx, batch); err != nil {
+			log.Printf("tracing: export failed: %v", err)
+		}
+		cancel()
+		batch = make([]*Span, 0, t.cfg.BatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-t.queue:
+				batch = append(batch, s)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.cfg.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			drain()
+			export()
+			close(ack)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(cctx.SpanKey).(*Span)
+	return s
+}
+
+type remoteParentKey struct{}
+
+// ContextWithRemoteParent makes sc, usually from Extract, the parent of the next started span.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext, true
+	}
+	sc, ok := ctx.Value(remoteParentKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
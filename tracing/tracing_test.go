@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mwdev22/rest/cctx"
+)
+
+type recordExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false, false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, false},
+		{"empty", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.header)
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got err %v", tt.valid, err)
+			}
+			if !tt.valid {
+				return
+			}
+			if sc.Sampled() != tt.sampled {
+				t.Errorf("expected sampled=%v, got %v", tt.sampled, sc.Sampled())
+			}
+			if tt.header[:2] == "00" && sc.Traceparent() != tt.header {
+				t.Errorf("expected round trip %s, got %s", tt.header, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := &recordExporter{}
+	tracer := NewTracer(Config{Exporter: exp})
+	defer tracer.Shutdown(context.Background())
+
+	r := chi.NewRouter()
+	r.Use(tracer.Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if cctx.TraceID(r.Context()) == "" {
+			t.Error("expected trace id in context")
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(exp.spans))
+	}
+	span := exp.spans[0]
+	if span.Name != "GET /users/{id}" {
+		t.Errorf("expected span named by route pattern, got %s", span.Name)
+	}
+	if span.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected incoming trace id, got %s", span.SpanContext.TraceID)
+	}
+	if span.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("expected remote parent, got %s", span.ParentSpanID)
+	}
+	if span.SpanContext.TraceState != "vendor=abc" {
+		t.Errorf("expected tracestate to be kept, got %s", span.SpanContext.TraceState)
+	}
+	if span.Kind != KindServer || span.Attributes["http.status_code"] != 500 || span.Err == "" {
+		t.Errorf("unexpected span %+v", span)
+	}
+}
+
+func TestMiddlewareUnsampledParent(t *testing.T) {
+	exp := &recordExporter{}
+	tracer := NewTracer(Config{Exporter: exp})
+	defer tracer.Shutdown(context.Background())
+
+	h := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	tracer.Flush(context.Background())
+	if len(exp.spans) != 0 {
+		t.Errorf("expected parent's sampling decision to be honoured, got %d spans", len(exp.spans))
+	}
+}
+
+func TestTransportPropagation(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	exp := &recordExporter{}
+	tracer := NewTracer(Config{Exporter: exp})
+	defer tracer.Shutdown(context.Background())
+
+	ctx, parent := tracer.Start(context.Background(), "job", KindInternal)
+	client := &http.Client{Transport: tracer.Transport(nil)}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.Finish()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Error("expected caller's request to be left untouched")
+	}
+	sc, err := ParseTraceparent(got.Get("traceparent"))
+	if err != nil {
+		t.Fatalf("expected traceparent upstream, got %q", got.Get("traceparent"))
+	}
+	if sc.TraceID != parent.SpanContext.TraceID {
+		t.Errorf("expected trace %s, got %s", parent.SpanContext.TraceID, sc.TraceID)
+	}
+
+	tracer.Flush(context.Background())
+	if len(exp.spans) != 2 {
+		t.Fatalf("expected client and parent spans, got %d", len(exp.spans))
+	}
+	cs := exp.spans[0]
+	if cs.Kind != KindClient || cs.SpanContext.SpanID != sc.SpanID || cs.ParentSpanID != parent.SpanContext.SpanID {
+		t.Errorf("unexpected client span %+v", cs)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]any
+	var path string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer(Config{Exporter: NewOTLPExporter(collector.URL+"/v1/traces", "orders", nil)})
+	_, span := tracer.Start(context.Background(), "GET /orders", KindServer)
+	span.SetAttribute("http.status_code", 200)
+	span.Finish()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("expected /v1/traces, got %s", path)
+	}
+	raw, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"service.name","value":{"stringValue":"orders"}`,
+		`"name":"GET /orders"`,
+		`"kind":2`,
+		`"traceId":"` + span.SpanContext.TraceID.String() + `"`,
+		`"key":"http.status_code","value":{"intValue":"200"}`,
+		`"status":{"code":0}`,
+	} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("missing %s in %s", want, raw)
+		}
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(Config{Exporter: NewStdoutExporter(&buf)})
+	_, span := tracer.Start(context.Background(), "work", KindInternal)
+	span.Finish()
+	tracer.Shutdown(context.Background())
+
+	if !strings.Contains(buf.String(), `"trace_id":"`+span.SpanContext.TraceID.String()+`"`) {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestRatioSampler(t *testing.T) {
+	never, always := RatioSampler(0), RatioSampler(1)
+	for range 100 {
+		id := newTraceID()
+		if never(id) || !always(id) {
+			t.Fatalf("unexpected decision for %s", id)
+		}
+	}
+}
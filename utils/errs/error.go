@@ -107,3 +107,105 @@ func ObjectNotFound(id string, name string) ApiError {
 		Log:        "",
 	}
 }
+
+func Conflict(reason string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusConflict,
+		Msg:        "conflict",
+		Log:        reason,
+	}
+}
+
+func ValidationFailed(err error) ApiError {
+	return ApiError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Msg:        "validation failed",
+		Log:        err.Error(),
+	}
+}
+
+func InvalidPatch(err error) ApiError {
+	return ApiError{
+		StatusCode: http.StatusBadRequest,
+		Msg:        "invalid patch",
+		Log:        err.Error(),
+	}
+}
+
+func FieldNotPatchable(path string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Msg:        fmt.Sprintf("field is not patchable: %s", path),
+	}
+}
+
+func UnsupportedMediaType(contentType string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Msg:        "unsupported media type",
+		Log:        fmt.Sprintf("unsupported content type: %s", contentType),
+	}
+}
+
+func ServiceUnavailable(reason string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusServiceUnavailable,
+		Msg:        "service unavailable",
+		Log:        reason,
+	}
+}
+
+func Timeout(reason string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusGatewayTimeout,
+		Msg:        "request timeout",
+		Log:        reason,
+	}
+}
+
+func UnsupportedEncoding(encoding string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Msg:        "unsupported content encoding",
+		Log:        fmt.Sprintf("unsupported content encoding: %s", encoding),
+	}
+}
+
+func InvalidCompressedBody(err error) ApiError {
+	return ApiError{
+		StatusCode: http.StatusBadRequest,
+		Msg:        "invalid compressed body",
+		Log:        err.Error(),
+	}
+}
+
+func TooManyEncodings(count, max int) ApiError {
+	return ApiError{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Msg:        "too many content encodings",
+		Log:        fmt.Sprintf("request stacks %d content encodings, at most %d allowed", count, max),
+	}
+}
+
+func RequestTooLarge(limit int64) ApiError {
+	return ApiError{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Msg:        "request body too large",
+		Log:        fmt.Sprintf("request body exceeds %d bytes", limit),
+	}
+}
+
+func PreconditionFailed(reason string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusPreconditionFailed,
+		Msg:        "precondition failed",
+		Log:        reason,
+	}
+}
+
+func PreconditionRequired(header string) ApiError {
+	return ApiError{
+		StatusCode: http.StatusPreconditionRequired,
+		Msg:        fmt.Sprintf("%s header required", header),
+	}
+}
@@ -476,3 +476,179 @@ func TestObjectNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestConflict(t *testing.T) {
+	err := Conflict("version mismatch")
+
+	if err.StatusCode != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, err.StatusCode)
+	}
+	if err.Msg != "conflict" {
+		t.Errorf("expected msg 'conflict', got '%s'", err.Msg)
+	}
+	if err.Log != "version mismatch" {
+		t.Errorf("expected log 'version mismatch', got '%s'", err.Log)
+	}
+}
+
+func TestValidationFailed(t *testing.T) {
+	err := ValidationFailed(errors.New("name is required"))
+
+	if err.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, err.StatusCode)
+	}
+	if err.Msg != "validation failed" {
+		t.Errorf("expected msg 'validation failed', got '%s'", err.Msg)
+	}
+	if err.Log != "name is required" {
+		t.Errorf("expected log 'name is required', got '%s'", err.Log)
+	}
+}
+
+func TestInvalidPatch(t *testing.T) {
+	err := InvalidPatch(errors.New("unknown operation"))
+
+	if err.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, err.StatusCode)
+	}
+	if err.Msg != "invalid patch" {
+		t.Errorf("expected msg 'invalid patch', got '%s'", err.Msg)
+	}
+	if err.Log != "unknown operation" {
+		t.Errorf("expected log 'unknown operation', got '%s'", err.Log)
+	}
+}
+
+func TestFieldNotPatchable(t *testing.T) {
+	err := FieldNotPatchable("/version")
+
+	if err.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, err.StatusCode)
+	}
+	if err.Msg != "field is not patchable: /version" {
+		t.Errorf("expected msg 'field is not patchable: /version', got '%s'", err.Msg)
+	}
+}
+
+func TestUnsupportedMediaType(t *testing.T) {
+	err := UnsupportedMediaType("text/plain")
+
+	if err.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, err.StatusCode)
+	}
+	if err.Msg != "unsupported media type" {
+		t.Errorf("expected msg 'unsupported media type', got '%s'", err.Msg)
+	}
+	if err.Log != "unsupported content type: text/plain" {
+		t.Errorf("expected log 'unsupported content type: text/plain', got '%s'", err.Log)
+	}
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	err := ServiceUnavailable("circuit open")
+
+	if err.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, err.StatusCode)
+	}
+	if err.Msg != "service unavailable" {
+		t.Errorf("expected msg 'service unavailable', got '%s'", err.Msg)
+	}
+	if err.Log != "circuit open" {
+		t.Errorf("expected log 'circuit open', got '%s'", err.Log)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	err := Timeout("exceeded 2s")
+
+	if err.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, err.StatusCode)
+	}
+	if err.Msg != "request timeout" {
+		t.Errorf("expected msg 'request timeout', got '%s'", err.Msg)
+	}
+	if err.Log != "exceeded 2s" {
+		t.Errorf("expected log 'exceeded 2s', got '%s'", err.Log)
+	}
+}
+
+func TestInvalidCompressedBody(t *testing.T) {
+	err := InvalidCompressedBody(errors.New("gzip: invalid header"))
+
+	if err.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, err.StatusCode)
+	}
+	if err.Msg != "invalid compressed body" {
+		t.Errorf("expected msg 'invalid compressed body', got '%s'", err.Msg)
+	}
+	if err.Log != "gzip: invalid header" {
+		t.Errorf("unexpected log '%s'", err.Log)
+	}
+}
+
+func TestTooManyEncodings(t *testing.T) {
+	err := TooManyEncodings(3, 2)
+
+	if err.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, err.StatusCode)
+	}
+	if err.Msg != "too many content encodings" {
+		t.Errorf("expected msg 'too many content encodings', got '%s'", err.Msg)
+	}
+	if err.Log != "request stacks 3 content encodings, at most 2 allowed" {
+		t.Errorf("unexpected log '%s'", err.Log)
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	err := UnsupportedEncoding("br")
+
+	if err.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, err.StatusCode)
+	}
+	if err.Msg != "unsupported content encoding" {
+		t.Errorf("expected msg 'unsupported content encoding', got '%s'", err.Msg)
+	}
+	if err.Log != "unsupported content encoding: br" {
+		t.Errorf("unexpected log '%s'", err.Log)
+	}
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	err := RequestTooLarge(1024)
+
+	if err.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, err.StatusCode)
+	}
+	if err.Msg != "request body too large" {
+		t.Errorf("expected msg 'request body too large', got '%s'", err.Msg)
+	}
+	if err.Log != "request body exceeds 1024 bytes" {
+		t.Errorf("unexpected log '%s'", err.Log)
+	}
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	err := PreconditionFailed("etag mismatch")
+
+	if err.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, err.StatusCode)
+	}
+	if err.Msg != "precondition failed" {
+		t.Errorf("expected msg 'precondition failed', got '%s'", err.Msg)
+	}
+	if err.Log != "etag mismatch" {
+		t.Errorf("expected log 'etag mismatch', got '%s'", err.Log)
+	}
+}
+
+func TestPreconditionRequired(t *testing.T) {
+	err := PreconditionRequired("If-Match")
+
+	if err.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("expected status %d, got %d", http.StatusPreconditionRequired, err.StatusCode)
+	}
+	if err.Msg != "If-Match header required" {
+		t.Errorf("expected msg 'If-Match header required', got '%s'", err.Msg)
+	}
+}
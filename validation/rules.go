@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator"
+)
+
+var (
+	phoneE164Regex = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	slugRegex      = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+var rules = map[string]validator.Func{
+	"iban":       isIBAN,
+	"pl_nip":     isPolishNIP,
+	"phone_e164": isPhoneE164,
+	"slug":       isSlug,
+}
+
+func isIBAN(fl validator.FieldLevel) bool {
+	return IBAN(fl.Field().String())
+}
+
+func isPolishNIP(fl validator.FieldLevel) bool {
+	return PolishNIP(fl.Field().String())
+}
+
+func isPhoneE164(fl validator.FieldLevel) bool {
+	return phoneE164Regex.MatchString(fl.Field().String())
+}
+
+func isSlug(fl validator.FieldLevel) bool {
+	return slugRegex.MatchString(fl.Field().String())
+}
+
+// IBAN checks the format and the ISO 13616 mod-97 checksum, spaces are ignored.
+func IBAN(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i < 2 && (c < 'A' || c > 'Z'):
+			return false
+		case i >= 2 && i < 4 && (c < '0' || c > '9'):
+			return false
+		case (c < '0' || c > '9') && (c < 'A' || c > 'Z'):
+			return false
+		}
+	}
+
+	rearranged := s[4:] + s[:4]
+	mod := 0
+	for _, c := range rearranged {
+		if c >= 'A' {
+			v := int(c-'A') + 10
+			mod = (mod*100 + v) % 97
+		} else {
+			mod = (mod*10 + int(c-'0')) % 97
+		}
+	}
+	return mod == 1
+}
+
+// PolishNIP checks a Polish tax identification number, dashes and spaces are ignored.
+func PolishNIP(s string) bool {
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	if len(s) != 10 {
+		return false
+	}
+
+	weights := []int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+	sum := 0
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+		if i < 9 {
+			sum += int(c-'0') * weights[i]
+		}
+	}
+	check := sum % 11
+	return check != 10 && check == int(s[9]-'0')
+}
@@ -0,0 +1,101 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-playground/validator"
+)
+
+// ErrRegistrationClosed is returned when a rule is registered after the first
+// validation, the underlying validator caches struct metadata and is not safe
+// to modify concurrently with validation.
+var ErrRegistrationClosed = errors.New("validation: rules must be registered before the first validation")
+
+type Validator struct {
+	mu     sync.Mutex
+	sealed atomic.Bool
+	v      *validator.Validate
+}
+
+// New returns a validator with the rules from this package (iban, pl_nip,
+// phone_e164, slug) already registered.
+func New() *Validator {
+	v := &Validator{v: validator.New()}
+	for tag, fn := range rules {
+		if err := v.v.RegisterValidation(tag, fn); err != nil {
+			panic(err)
+		}
+	}
+	return v
+}
+
+func (v *Validator) RegisterRule(tag string, fn validator.Func) error {
+	return v.register(func(vv *validator.Validate) error {
+		return vv.RegisterValidation(tag, fn)
+	})
+}
+
+// RegisterRuleCtx registers a rule receiving the context passed to StructCtx,
+// use it for checks that hit a repository (e.g. uniqueness).
+func (v *Validator) RegisterRuleCtx(tag string, fn validator.FuncCtx) error {
+	return v.register(func(vv *validator.Validate) error {
+		return vv.RegisterValidationCtx(tag, fn)
+	})
+}
+
+func (v *Validator) RegisterStructRule(fn validator.StructLevelFunc, types ...any) error {
+	return v.register(func(vv *validator.Validate) error {
+		vv.RegisterStructValidation(fn, types...)
+		return nil
+	})
+}
+
+func (v *Validator) RegisterStructRuleCtx(fn validator.StructLevelFuncCtx, types ...any) error {
+	return v.register(func(vv *validator.Validate) error {
+		vv.RegisterStructValidationCtx(fn, types...)
+		return nil
+	})
+}
+
+func (v *Validator) RegisterAlias(alias, tags string) error {
+	return v.register(func(vv *validator.Validate) error {
+		vv.RegisterAlias(alias, tags)
+		return nil
+	})
+}
+
+func (v *Validator) Struct(s any) error {
+	return v.StructCtx(context.Background(), s)
+}
+
+func (v *Validator) StructCtx(ctx context.Context, s any) error {
+	v.seal()
+	return v.v.StructCtx(ctx, s)
+}
+
+func (v *Validator) Var(field any, tag string) error {
+	v.seal()
+	return v.v.Var(field, tag)
+}
+
+func (v *Validator) register(fn func(*validator.Validate) error) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.sealed.Load() {
+		return ErrRegistrationClosed
+	}
+	return fn(v.v)
+}
+
+func (v *Validator) seal() {
+	if v.sealed.Load() {
+		return
+	}
+	// wait for a registration in progress to finish
+	v.mu.Lock()
+	v.sealed.Store(true)
+	v.mu.Unlock()
+}
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/mwdev22/rest/jsonutil"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		tag   string
+		value string
+		valid bool
+	}{
+		{"iban", "GB82 WEST 1234 5698 7654 32", true},
+		{"iban", "PL61109010140000071219812874", true},
+		{"iban", "GB82 WEST 1234 5698 7654 33", false},
+		{"iban", "GB82", false},
+		{"pl_nip", "526-025-09-95", true},
+		{"pl_nip", "7740001454", true},
+		{"pl_nip", "1234567890", false},
+		{"pl_nip", "52602509", false},
+		{"phone_e164", "+48123456789", true},
+		{"phone_e164", "48123456789", false},
+		{"phone_e164", "+0123", false},
+		{"slug", "hello-world-2", true},
+		{"slug", "Hello-World", false},
+		{"slug", "hello--world", false},
+		{"slug", "-hello", false},
+	}
+
+	v := New()
+	for _, tt := range tests {
+		t.Run(tt.tag+"/"+tt.value, func(t *testing.T) {
+			err := v.Var(tt.value, tt.tag)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v for %q, got %v", tt.valid, tt.value, err)
+			}
+		})
+	}
+}
+
+type dateRange struct {
+	From int `validate:"required"`
+	To   int `validate:"required"`
+}
+
+type signup struct {
+	Email string `json:"email" validate:"required,unique_email"`
+}
+
+type emailRepoKey struct{}
+
+func TestStructRules(t *testing.T) {
+	v := New()
+	err := v.RegisterStructRule(func(sl validator.StructLevel) {
+		r := sl.Current().Interface().(dateRange)
+		if r.To < r.From {
+			sl.ReportError(r.To, "To", "To", "gtefield", "From")
+		}
+	}, dateRange{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value dateRange
+		valid bool
+	}{
+		{"ordered", dateRange{From: 1, To: 2}, true},
+		{"equal", dateRange{From: 2, To: 2}, true},
+		{"reversed", dateRange{From: 3, To: 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Struct(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestContextRules(t *testing.T) {
+	v := New()
+	err := v.RegisterRuleCtx("unique_email", func(ctx context.Context, fl validator.FieldLevel) bool {
+		taken, _ := ctx.Value(emailRepoKey{}).(map[string]bool)
+		return !taken[fl.Field().String()]
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"free email", `{"email":"new@example.com"}`, true},
+		{"taken email", `{"email":"taken@example.com"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), emailRepoKey{}, map[string]bool{"taken@example.com": true})
+
+			var s signup
+			err := jsonutil.ParseWith(req.WithContext(ctx), &s, v)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got %v", tt.valid, err)
+			}
+
+			patch := httptest.NewRequest(http.MethodPatch, "/signup", strings.NewReader(tt.body))
+			patch.Header.Set("Content-Type", jsonutil.MergePatchContentType)
+			s = signup{Email: "old@example.com"}
+			err = jsonutil.ParsePatchWith(patch.WithContext(ctx), &s, v)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected patch valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestRegistrationClosed(t *testing.T) {
+	v := New()
+	if err := v.Struct(dateRange{From: 1, To: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := v.RegisterRule("late", func(fl validator.FieldLevel) bool { return true })
+	if !errors.Is(err, ErrRegistrationClosed) {
+		t.Errorf("expected ErrRegistrationClosed, got %v", err)
+	}
+}